@@ -0,0 +1,153 @@
+package basic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// anomalyDetectorsTTL is a time during which anomaly detector existence is not re-checked.
+const anomalyDetectorsTTL = time.Hour
+
+// anomalyDetectorsCache caches results of DescribeAnomalyDetectors calls between scrapes.
+type anomalyDetectorsCache struct {
+	m       sync.Mutex
+	entries map[string]anomalyDetectorsEntry // region/instance/metric/dimensions -> entry
+}
+
+type anomalyDetectorsEntry struct {
+	exists  bool
+	checked time.Time
+}
+
+// get returns cached detector existence for the given key, if it is not expired.
+func (c *anomalyDetectorsCache) get(key string, now time.Time) (exists, ok bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || now.Sub(e.checked) > anomalyDetectorsTTL {
+		return false, false
+	}
+	return e.exists, true
+}
+
+// set stores detector existence for the given key.
+func (c *anomalyDetectorsCache) set(key string, exists bool, now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]anomalyDetectorsEntry)
+	}
+	c.entries[key] = anomalyDetectorsEntry{exists: exists, checked: now}
+}
+
+// anomalyDetectorExists returns true if CloudWatch anomaly detector is configured for the metric of the instance.
+func (s *Scraper) anomalyDetectorExists(metric Metric) (bool, error) {
+	key := s.instance.Region + "/" + s.instance.Instance + "/" + metricKey(metric)
+
+	now := time.Now()
+	if exists, ok := s.collector.anomalyDetectors.get(key, now); ok {
+		return exists, nil
+	}
+
+	resp, err := s.svc.DescribeAnomalyDetectorsWithContext(s.ctx, &cloudwatch.DescribeAnomalyDetectorsInput{
+		Namespace:  aws.String("AWS/RDS"),
+		MetricName: aws.String(metric.cwName),
+		Dimensions: s.dimensions(metric),
+	})
+	if err != nil {
+		return false, &apiError{api: "DescribeAnomalyDetectors", err: err}
+	}
+
+	exists := len(resp.AnomalyDetectors) > 0
+	s.collector.anomalyDetectors.set(key, exists, now)
+	return exists, nil
+}
+
+// scrapeAnomalyBand sends the latest CloudWatch anomaly detection band bounds for the metric
+// if anomaly detector exists.
+func (s *Scraper) scrapeAnomalyBand(metric Metric) error {
+	exists, err := s.anomalyDetectorExists(metric)
+	if err != nil || !exists {
+		return err
+	}
+
+	resp, err := s.svc.GetMetricDataWithContext(s.ctx, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(s.start),
+		EndTime:   aws.Time(s.end),
+		MetricDataQueries: []*cloudwatch.MetricDataQuery{{
+			Id: aws.String("m"),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String("AWS/RDS"),
+					MetricName: aws.String(metric.cwName),
+					Dimensions: s.dimensions(metric),
+				},
+				Period: aws.Int64(int64(s.period.Seconds())),
+				Stat:   aws.String("Average"),
+			},
+			ReturnData: aws.Bool(false),
+		}, {
+			Id:         aws.String("band"),
+			Expression: aws.String("ANOMALY_DETECTION_BAND(m)"),
+			ReturnData: aws.Bool(true),
+		}},
+	})
+	if err != nil {
+		return &apiError{api: "GetMetricData", err: err}
+	}
+
+	upper, lower, ok := bandBounds(resp.MetricDataResults)
+	if !ok {
+		return nil
+	}
+
+	constLabels := s.labels(metric)
+	for _, b := range []struct {
+		suffix string
+		help   string
+		value  float64
+	}{
+		{"_anomaly_upper", "Upper bound of CloudWatch anomaly detection band for " + metric.cwName + ".", upper},
+		{"_anomaly_lower", "Lower bound of CloudWatch anomaly detection band for " + metric.cwName + ".", lower},
+	} {
+		s.ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(baseName(metric)+b.suffix, b.help, nil, constLabels),
+			prometheus.GaugeValue,
+			convertValue(metric, b.value),
+		)
+	}
+	return nil
+}
+
+// bandBounds returns the latest upper and lower bounds of anomaly detection band.
+// The band is returned as two series with the same ID; the series with a greater value is the upper one.
+func bandBounds(results []*cloudwatch.MetricDataResult) (upper, lower float64, ok bool) {
+	var latest []float64
+	for _, r := range results {
+		if aws.StringValue(r.Id) != "band" || len(r.Values) == 0 || len(r.Values) != len(r.Timestamps) {
+			continue
+		}
+
+		i := 0
+		for j := range r.Timestamps {
+			if r.Timestamps[j].After(*r.Timestamps[i]) {
+				i = j
+			}
+		}
+		latest = append(latest, aws.Float64Value(r.Values[i]))
+	}
+
+	if len(latest) != 2 {
+		return 0, 0, false
+	}
+	if latest[0] < latest[1] {
+		latest[0], latest[1] = latest[1], latest[0]
+	}
+	return latest[0], latest[1], true
+}
@@ -0,0 +1,113 @@
+package basic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestBandBounds(t *testing.T) {
+	t0 := time.Date(2020, 6, 2, 10, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+
+	upper, lower, ok := bandBounds([]*cloudwatch.MetricDataResult{{
+		Id:         aws.String("band"),
+		Timestamps: []*time.Time{aws.Time(t1), aws.Time(t0)},
+		Values:     aws.Float64Slice([]float64{10, 100}),
+	}, {
+		Id:         aws.String("band"),
+		Timestamps: []*time.Time{aws.Time(t0), aws.Time(t1)},
+		Values:     aws.Float64Slice([]float64{200, 20}),
+	}})
+	assert.True(t, ok)
+	assert.Equal(t, 20.0, upper)
+	assert.Equal(t, 10.0, lower)
+
+	_, _, ok = bandBounds([]*cloudwatch.MetricDataResult{{
+		Id:         aws.String("band"),
+		Timestamps: []*time.Time{aws.Time(t0)},
+		Values:     aws.Float64Slice([]float64{10}),
+	}})
+	assert.False(t, ok)
+}
+
+func TestAnomalyDetectorsCache(t *testing.T) {
+	var c anomalyDetectorsCache
+	now := time.Now()
+
+	_, ok := c.get("key", now)
+	assert.False(t, ok)
+
+	c.set("key", true, now)
+	exists, ok := c.get("key", now.Add(time.Minute))
+	assert.True(t, ok)
+	assert.True(t, exists)
+
+	_, ok = c.get("key", now.Add(anomalyDetectorsTTL+time.Minute))
+	assert.False(t, ok)
+}
+
+// bandCloudWatch is a CloudWatch API stub that returns a fixed anomaly detection band.
+type bandCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+}
+
+func (bandCloudWatch) GetMetricDataWithContext(aws.Context, *cloudwatch.GetMetricDataInput, ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	t := time.Now()
+	return &cloudwatch.GetMetricDataOutput{
+		MetricDataResults: []*cloudwatch.MetricDataResult{{
+			Id:         aws.String("band"),
+			Timestamps: []*time.Time{aws.Time(t)},
+			Values:     aws.Float64Slice([]float64{30}),
+		}, {
+			Id:         aws.String("band"),
+			Timestamps: []*time.Time{aws.Time(t)},
+			Values:     aws.Float64Slice([]float64{10}),
+		}},
+	}, nil
+}
+
+func TestScrapeAnomalyBand(t *testing.T) {
+	collector := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	ch := make(chan prometheus.Metric, 10)
+	s := &Scraper{
+		instance:        &config.Instance{Region: "us-east-1", Instance: "db1"},
+		collector:       collector,
+		ch:              ch,
+		ctx:             context.Background(),
+		sessionInstance: &sessions.Instance{Region: "us-east-1", Instance: "db1"},
+		svc:             bandCloudWatch{},
+		period:          Period,
+	}
+
+	var metric Metric
+	for _, m := range Metrics {
+		if m.cwName == "CPUUtilization" {
+			metric = m
+		}
+	}
+	require.Equal(t, "node_cpu_average", metric.prometheusName)
+	collector.anomalyDetectors.set("us-east-1/db1/"+metricKey(metric), true, time.Now())
+
+	require.NoError(t, s.scrapeAnomalyBand(metric))
+	close(ch)
+	var descs []string
+	for m := range ch {
+		descs = append(descs, m.Desc().String())
+	}
+	require.Len(t, descs, 2)
+	assert.Contains(t, descs[0], `fqName: "node_cpu_anomaly_upper"`)
+	assert.Contains(t, descs[1], `fqName: "node_cpu_anomaly_lower"`)
+}
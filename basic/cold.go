@@ -0,0 +1,104 @@
+package basic
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ColdThreshold is a number of consecutive scrapes without any datapoints after which instance is considered cold
+	// (likely stopped or just created); 0 disables cold instances detection.
+	ColdThreshold = 0
+
+	// ColdScrapeEvery makes cold instances scraped only once in that number of collections; 1 scrapes them always.
+	ColdScrapeEvery = 1
+)
+
+// coldState tracks scrapes of a single instance.
+type coldState struct {
+	streak  int // consecutive scrapes without datapoints
+	skipped int // collections skipped since the last scrape
+}
+
+// coldInstances tracks instances without datapoints.
+type coldInstances struct {
+	m      sync.Mutex
+	states map[string]*coldState // region/instance -> state
+}
+
+// state returns state for the given key. Must be called with c.m held.
+func (c *coldInstances) state(key string) *coldState {
+	if c.states == nil {
+		c.states = make(map[string]*coldState)
+	}
+	st := c.states[key]
+	if st == nil {
+		st = new(coldState)
+		c.states[key] = st
+	}
+	return st
+}
+
+// skip returns true if the instance is cold and should not be scraped during this collection.
+func (c *coldInstances) skip(key string) bool {
+	if ColdThreshold <= 0 || ColdScrapeEvery <= 1 {
+		return false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	st := c.state(key)
+	if st.streak < ColdThreshold {
+		return false
+	}
+	st.skipped++
+	if st.skipped < ColdScrapeEvery {
+		return true
+	}
+	st.skipped = 0
+	return false
+}
+
+// observe records scrape result and returns true if the instance is cold.
+func (c *coldInstances) observe(key string, empty bool) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	st := c.state(key)
+	if empty {
+		st.streak++
+	} else {
+		st.streak = 0
+	}
+	return ColdThreshold > 0 && st.streak >= ColdThreshold
+}
+
+// streak returns the number of consecutive scrapes without datapoints.
+func (c *coldInstances) streak(key string) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if st := c.states[key]; st != nil {
+		return st.streak
+	}
+	return 0
+}
+
+// sendCold sends cold instance gauge.
+func (s *Scraper) sendCold(cold bool) {
+	v := 0.0
+	if cold {
+		v = 1
+	}
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_instance_cold",
+			"1 if the instance returned no datapoints for any metric during several consecutive scrapes, 0 otherwise.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		v,
+	)
+}
@@ -0,0 +1,39 @@
+package basic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColdInstances(t *testing.T) {
+	defer func(threshold, every int) {
+		ColdThreshold, ColdScrapeEvery = threshold, every
+	}(ColdThreshold, ColdScrapeEvery)
+	ColdThreshold, ColdScrapeEvery = 2, 3
+
+	var c coldInstances
+	const key = "us-east-1/test"
+
+	assert.False(t, c.skip(key))
+	assert.False(t, c.observe(key, true))
+	assert.False(t, c.skip(key))
+	assert.True(t, c.observe(key, true))
+
+	// cold: scraped only once in 3 collections
+	assert.True(t, c.skip(key))
+	assert.True(t, c.skip(key))
+	assert.False(t, c.skip(key))
+	assert.True(t, c.observe(key, true))
+	assert.True(t, c.skip(key))
+
+	// warm again
+	assert.False(t, c.observe(key, false))
+	assert.False(t, c.skip(key))
+
+	ColdThreshold = 0
+	assert.False(t, c.observe(key, true))
+	assert.False(t, c.observe(key, true))
+	assert.False(t, c.observe(key, true))
+	assert.False(t, c.skip(key))
+}
@@ -1,7 +1,10 @@
 package basic
 
 import (
+	"context"
 	"fmt"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +18,9 @@ import (
 
 //go:generate go run generate/main.go generate/utils.go
 
+// RegionConcurrency is a maximum number of regions scraped concurrently; 0 means no limit.
+var RegionConcurrency = 0
+
 var (
 	scrapeTimeDesc = prometheus.NewDesc(
 		"rds_exporter_scrape_duration_seconds",
@@ -22,29 +28,238 @@ var (
 		[]string{},
 		nil,
 	)
+	neverSeenDesc = prometheus.NewDesc(
+		"rds_exporter_metric_never_seen",
+		"1 if no instance returned datapoints for the metric since configuration load.",
+		[]string{"metric"},
+		nil,
+	)
 )
 
 type Metric struct {
-	cwName         string
-	prometheusName string
-	prometheusHelp string
+	cwName             string
+	prometheusName     string
+	prometheusHelp     string
+	statistics         []string // CloudWatch statistics to send; empty for Average only
+	extendedStatistics []string
+	percentileSuffix   bool              // use name suffix instead of quantile label for percentiles
+	minValue           *float64          // values below are not sent
+	maxValue           *float64          // values above are not sent
+	dimensions         map[string]string // CloudWatch dimensions in addition to DBInstanceIdentifier
+	anomalyBand        bool              // also send CloudWatch anomaly detection band
+	ratio              bool              // send Percent values as 0-1 ratios
+	stddev             bool              // also send standard deviation of averages over the range
+	scale              float64           // values are multiplied by it; 0 means 1
+	clusterDimension   bool              // use DBClusterIdentifier dimension instead of DBInstanceIdentifier
+	stale              bool              // sent value is the last good one from a previous scrape
+}
+
+// sentStatistics returns CloudWatch statistics (not extended ones) that should be sent.
+func (m Metric) sentStatistics() []string {
+	if len(m.statistics) == 0 {
+		return []string{"Average"}
+	}
+	return m.statistics
+}
+
+// requestedStatistics returns CloudWatch statistics (not extended ones) that should be requested.
+// Average is always requested, because it is used for derived metrics.
+func (m Metric) requestedStatistics() []string {
+	res := []string{"Average"}
+	for _, s := range m.sentStatistics() {
+		if s != "Average" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// filtered returns true if value should not be sent.
+func (m Metric) filtered(v float64) bool {
+	return (m.minValue != nil && v < *m.minValue) || (m.maxValue != nil && v > *m.maxValue)
 }
 
 type Collector struct {
 	config   *config.Config
 	sessions *sessions.Sessions
-	metrics  []Metric
 	l        log.Logger
+
+	rw            sync.RWMutex
+	metrics       []Metric
+	engineMetrics map[string][]Metric // engine -> metrics collected in addition to common ones
+
+	anomalyDetectors anomalyDetectorsCache
+	cold             coldInstances
+	lastDatapoints   lastDatapoints
+	scrapes          scrapeStates
+
+	seenM sync.Mutex
+	seen  map[string]bool // metricKey -> true if any instance returned datapoint for it since configuration load
+
+	mRegionPanics       *prometheus.CounterVec
+	mInstanceAPIErrors  *prometheus.CounterVec
+	mCloudWatchRequests *prometheus.CounterVec
 }
 
 // New creates a new instance of a Collector.
 func New(config *config.Config, sessions *sessions.Sessions, logger log.Logger) *Collector {
-	return &Collector{
+	c := &Collector{
 		config:   config,
 		sessions: sessions,
-		metrics:  Metrics,
 		l:        log.With(logger, "component", "basic"),
+
+		mRegionPanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rds_exporter_region_scrape_panics_total",
+			Help: "Total number of recovered panics during basic metrics scrapes, by region.",
+		}, []string{"region"}),
+		mInstanceAPIErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rds_exporter_instance_api_errors_total",
+			Help: "Total number of AWS API errors during basic metrics scrapes, by instance and API.",
+		}, []string{"region", "instance", "api"}),
+		mCloudWatchRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rds_exporter_cloudwatch_requests_total",
+			Help: "Total number of CloudWatch API requests (including retries) during basic metrics scrapes, by region and API.",
+		}, []string{"region", "api"}),
+	}
+	c.SetMetricsConfig(config)
+
+	for _, instance := range config.Instances {
+		requested := Period
+		if instance.Period > 0 {
+			requested = instance.Period
+		}
+		if p, _, _ := scrapeWindow(&instance); p != requested {
+			level.Warn(c.l).Log("msg", fmt.Sprintf("Period %s is not usable for %s with resolution %s, using %s.", requested, instance, instance.Resolution, p))
+		}
 	}
+	return c
+}
+
+// SetMetricsConfig atomically replaces metrics settings with ones from given configuration; instances are not changed.
+// It is safe to call it concurrently with Collect; scrapes that are already running use previous settings.
+func (e *Collector) SetMetricsConfig(cfg *config.Config) {
+	suffix := cfg.StatisticNaming == config.StatisticNamingSuffix
+	metrics, other := applyConfig(Metrics, cfg.Metrics, suffix)
+	postgreSQLMetrics, other := applyConfig(PostgreSQLMetrics, other, suffix)
+	auroraMySQLMetrics, other := applyConfig(AuroraMySQLMetrics, other, suffix)
+	for _, m := range other {
+		level.Info(e.l).Log("msg", fmt.Sprintf("Adding custom metric %s from configuration file.", m.Name))
+		metrics = append(metrics, customMetric(m, suffix))
+	}
+
+	e.seenM.Lock()
+	e.seen = make(map[string]bool)
+	e.seenM.Unlock()
+
+	e.rw.Lock()
+	defer e.rw.Unlock()
+
+	e.metrics = metrics
+	e.engineMetrics = map[string][]Metric{
+		"postgres":          postgreSQLMetrics,
+		"aurora-postgresql": postgreSQLMetrics,
+		"aurora":            auroraMySQLMetrics,
+		"aurora-mysql":      auroraMySQLMetrics,
+	}
+}
+
+// metricsFor returns metrics that should be collected for given engine.
+func (e *Collector) metricsFor(engine string) []Metric {
+	e.rw.RLock()
+	defer e.rw.RUnlock()
+
+	// common metrics plus engine-specific ones
+	extra := e.engineMetrics[engine]
+	res := make([]Metric, 0, len(e.metrics)+len(extra))
+	res = append(res, e.metrics...)
+	res = append(res, extra...)
+	return res
+}
+
+// applyConfig returns a copy of metrics with settings from configuration file applied,
+// and configuration of metrics not found there.
+func applyConfig(metrics []Metric, configs []config.Metric, percentileSuffix bool) ([]Metric, []config.Metric) {
+	res := make([]Metric, len(metrics))
+	copy(res, metrics)
+	for i := range res {
+		res[i].percentileSuffix = percentileSuffix
+	}
+
+	var other []config.Metric
+	for _, c := range configs {
+		var found bool
+		for i := range res {
+			if res[i].cwName != c.Name {
+				continue
+			}
+			res[i].statistics = c.Statistics
+			res[i].extendedStatistics = c.ExtendedStatistics
+			res[i].minValue = c.MinValue
+			res[i].maxValue = c.MaxValue
+			res[i].dimensions = c.Dimensions
+			res[i].anomalyBand = c.AnomalyBand
+			res[i].ratio = c.Ratio
+			res[i].stddev = c.Stddev
+			res[i] = convertedMetric(res[i], c)
+			found = true
+		}
+		if !found {
+			other = append(other, c)
+		}
+	}
+
+	return res, other
+}
+
+// ratioMetric returns a copy of metric with Percent values sent as 0-1 ratio with "_ratio" suffix.
+func ratioMetric(m Metric) Metric {
+	m.prometheusName = baseName(m) + "_ratio"
+	m.prometheusHelp += " (as 0-1 ratio)"
+	m.ratio = false
+	m.scale = m.scaleFactor() / 100
+	return m
+}
+
+// scaleFactor returns a factor values are multiplied by.
+func (m Metric) scaleFactor() float64 {
+	if m.scale == 0 {
+		return 1
+	}
+	return m.scale
+}
+
+// customMetric returns metric not known to the exporter with settings from configuration file.
+func customMetric(c config.Metric, percentileSuffix bool) Metric {
+	return convertedMetric(Metric{
+		cwName:             c.Name,
+		prometheusName:     "aws_rds_" + config.SnakeCase(c.Name) + "_average",
+		prometheusHelp:     c.Name,
+		statistics:         c.Statistics,
+		extendedStatistics: c.ExtendedStatistics,
+		percentileSuffix:   percentileSuffix,
+		minValue:           c.MinValue,
+		maxValue:           c.MaxValue,
+		dimensions:         c.Dimensions,
+		anomalyBand:        c.AnomalyBand,
+		ratio:              c.Ratio,
+		stddev:             c.Stddev,
+	}, c)
+}
+
+// convertedMetric returns a copy of metric with scale factor and target unit from configuration file applied.
+func convertedMetric(m Metric, c config.Metric) Metric {
+	if c.ScaleFactor != nil {
+		m.scale = *c.ScaleFactor
+	}
+	if c.TargetUnit != "" {
+		name := baseName(m) + "_" + c.TargetUnit
+		if strings.HasSuffix(m.prometheusName, "_average") {
+			name += "_average"
+		}
+		m.prometheusName = name
+		m.prometheusHelp += " (converted to " + c.TargetUnit + ")"
+	}
+	return m
 }
 
 func (e *Collector) Describe(ch chan<- *prometheus.Desc) {
@@ -53,36 +268,144 @@ func (e *Collector) Describe(ch chan<- *prometheus.Desc) {
 
 func (e *Collector) Collect(ch chan<- prometheus.Metric) {
 	now := time.Now()
-	e.collect(ch)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if ScrapeTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), ScrapeTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	e.collect(ctx, ch)
+	e.lastDatapoints.evict(time.Now())
 
 	// Collect scrape time
 	ch <- prometheus.MustNewConstMetric(scrapeTimeDesc, prometheus.GaugeValue, time.Since(now).Seconds())
-}
 
-func (e *Collector) collect(ch chan<- prometheus.Metric) {
-	var wg sync.WaitGroup
-	defer wg.Wait()
+	e.sendNeverSeen(ch)
+
+	e.mRegionPanics.Collect(ch)
+	e.mInstanceAPIErrors.Collect(ch)
+	e.mCloudWatchRequests.Collect(ch)
+}
 
+func (e *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	// group instances by region, keeping configuration order
+	var regions []string
+	instances := make(map[string][]config.Instance)
 	for _, instance := range e.config.Instances {
 		if instance.DisableBasicMetrics {
 			level.Debug(e.l).Log("msg", fmt.Sprintf("Instance %s has disabled basic metrics, skipping.", instance))
 			continue
 		}
+		if _, ok := instances[instance.Region]; !ok {
+			regions = append(regions, instance.Region)
+		}
+		instances[instance.Region] = append(instances[instance.Region], instance)
+	}
+
+	limit := RegionConcurrency
+	if limit <= 0 || limit > len(regions) {
+		limit = len(regions)
+	}
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, region := range regions {
+		region := region
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				level.Error(e.l).Log("msg", fmt.Sprintf("Scrape timeout, skipping region %s.", region), "error", ctx.Err())
+				return
+			}
+
+			e.collectRegion(ctx, region, instances[region], ch)
+		}()
+	}
+}
+
+// collectRegion scrapes all instances in a single region with a separate context derived from the given one.
+// Panics are recovered, so other regions are not affected.
+func (e *Collector) collectRegion(ctx context.Context, region string, instances []config.Instance, ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, instance := range instances {
 		instance := instance
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			defer e.recoverRegion(region, cancel)
 
-			s := NewScraper(&instance, e, ch)
+			key := instance.Region + "/" + instance.Instance
+			start := time.Now()
+			s := NewScraper(ctx, &instance, e, ch)
 			if s == nil {
 				level.Error(e.l).Log("msg", fmt.Sprintf("No scraper for %s, skipping.", instance))
+				e.scrapes.store(key, ScrapeState{Time: start, Status: "no_scraper"})
+				return
+			}
+			if e.cold.skip(key) {
+				level.Debug(e.l).Log("msg", fmt.Sprintf("Instance %s is cold, skipping.", instance))
+				s.sendCold(true)
+				e.scrapes.store(key, ScrapeState{Time: start, Status: "cold"})
 				return
 			}
 			s.Scrape()
+			e.scrapes.store(key, s.state(start))
 		}()
 	}
 }
 
+// observeMetrics records which of scraped metrics returned datapoints.
+func (e *Collector) observeMetrics(metrics []Metric, values map[string]float64) {
+	e.seenM.Lock()
+	defer e.seenM.Unlock()
+
+	for _, m := range metrics {
+		key := metricKey(m)
+		_, ok := values[key]
+		e.seen[key] = e.seen[key] || ok
+	}
+}
+
+// sendNeverSeen sends metrics that were scraped, but never returned datapoints since configuration load.
+func (e *Collector) sendNeverSeen(ch chan<- prometheus.Metric) {
+	e.seenM.Lock()
+	defer e.seenM.Unlock()
+
+	for name, seen := range e.seen {
+		if seen {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(neverSeenDesc, prometheus.GaugeValue, 1, name)
+	}
+}
+
+// recoverRegion recovers from a panic in region scrape goroutine, logs it, and calls cancel
+// to stop other goroutines of the same scrape promptly. It should be called directly by defer.
+func (e *Collector) recoverRegion(region string, cancel context.CancelFunc) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	cancel()
+	e.mRegionPanics.WithLabelValues(region).Inc()
+	level.Error(e.l).Log("msg", "Panic during scrape, region results may be incomplete.", "region", region, "panic", r, "stack", string(debug.Stack()))
+}
+
 // check interfaces
 var (
 	_ prometheus.Collector = (*Collector)(nil)
@@ -1,12 +1,17 @@
 package basic
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/promlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,12 +26,13 @@ func TestCollector(t *testing.T) {
 	require.NoError(t, err)
 	logger := promlog.New(&promlog.Config{})
 	client := client.New(logger)
-	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false)
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false, false)
 	require.NoError(t, err)
 
 	c := New(cfg, sess, logger)
 
 	actualMetrics := helpers.ReadMetrics(helpers.CollectMetrics(c))
+	actualMetrics = withoutUnitTested(actualMetrics)
 	sort.Slice(actualMetrics, func(i, j int) bool { return actualMetrics[i].Less(actualMetrics[j]) })
 	actualLines := helpers.Format(helpers.WriteMetrics(actualMetrics))
 
@@ -51,6 +57,29 @@ func TestCollector(t *testing.T) {
 	assert.Equal(t, expectedMetrics, actualMetrics)
 }
 
+// unitTestedMetrics are exporter's own metrics that are checked by unit tests with stubbed CloudWatch
+// instead of the golden file.
+var unitTestedMetrics = map[string]struct{}{
+	"rds_exporter_cloudwatch_requests_total":            {},
+	"rds_exporter_effective_period_seconds":             {},
+	"rds_exporter_instance_metrics_collected":           {},
+	"rds_exporter_instance_metrics_configured":          {},
+	"rds_exporter_metric_never_seen":                    {},
+	"rds_exporter_query_window_end_timestamp_seconds":   {},
+	"rds_exporter_query_window_start_timestamp_seconds": {},
+}
+
+// withoutUnitTested returns metrics without unitTestedMetrics.
+func withoutUnitTested(metrics []*helpers.Metric) []*helpers.Metric {
+	res := make([]*helpers.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if _, ok := unitTestedMetrics[m.Name]; !ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
 func TestCollectorDisableBasicMetrics(t *testing.T) {
 	cfg, err := config.Load("../config.tests.yml")
 	require.NoError(t, err)
@@ -65,7 +94,7 @@ func TestCollectorDisableBasicMetrics(t *testing.T) {
 		// Groups instance names by disabled or enabled metrics.
 		instanceGroups[isDisabled] = append(instanceGroups[isDisabled], cfg.Instances[i].Instance)
 	}
-	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false)
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false, false)
 	require.NoError(t, err)
 
 	c := New(cfg, sess, logger)
@@ -93,3 +122,68 @@ func TestCollectorDisableBasicMetrics(t *testing.T) {
 		assert.Truef(t, hasMetricForInstance(actualLines, inst), "Did not find metrics for enabled instance %s", inst)
 	}
 }
+
+func TestRecoverRegion(t *testing.T) {
+	c := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer c.recoverRegion("us-east-1", cancel)
+
+		panic("test")
+	}()
+	<-done
+
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.mRegionPanics.WithLabelValues("us-east-1")))
+}
+
+func TestConvertedMetric(t *testing.T) {
+	metric := Metric{
+		cwName:         "ReadLatency",
+		prometheusName: "aws_rds_read_latency_average",
+		prometheusHelp: "ReadLatency",
+	}
+	assert.Equal(t, metric, convertedMetric(metric, config.Metric{Name: "ReadLatency"}))
+
+	scale := 1000.0
+	m := convertedMetric(metric, config.Metric{Name: "ReadLatency", ScaleFactor: &scale, TargetUnit: "milliseconds"})
+	assert.Equal(t, "aws_rds_read_latency_milliseconds_average", m.prometheusName)
+	assert.Equal(t, "ReadLatency (converted to milliseconds)", m.prometheusHelp)
+	assert.Equal(t, []statisticValue{{"Average", 500}}, datapointValues(m, &cloudwatch.Datapoint{Average: aws.Float64(0.5)}))
+
+	// names without statistic suffix
+	m = convertedMetric(Metric{prometheusName: "aws_rds_replica_lag"}, config.Metric{TargetUnit: "seconds"})
+	assert.Equal(t, "aws_rds_replica_lag_seconds", m.prometheusName)
+}
+
+func TestNeverSeen(t *testing.T) {
+	c := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	metrics := []Metric{
+		{cwName: "CPUUtilization"},
+		{cwName: "NoSuchMetric"},
+		{cwName: "CPUUtilization", dimensions: map[string]string{"Role": "WRITER"}},
+	}
+
+	c.observeMetrics(metrics, map[string]float64{"CPUUtilization": 1})
+	c.observeMetrics(metrics[:1], map[string]float64{})
+	expected := `# HELP rds_exporter_metric_never_seen 1 if no instance returned datapoints for the metric since configuration load.
+# TYPE rds_exporter_metric_never_seen gauge
+rds_exporter_metric_never_seen{metric="CPUUtilization{Role=WRITER}"} 1
+rds_exporter_metric_never_seen{metric="NoSuchMetric"} 1
+`
+	collector := neverSeenCollector{c}
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+
+	// reset on reload
+	c.SetMetricsConfig(new(config.Config))
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+}
+
+type neverSeenCollector struct{ c *Collector }
+
+func (n neverSeenCollector) Describe(ch chan<- *prometheus.Desc) { ch <- neverSeenDesc }
+func (n neverSeenCollector) Collect(ch chan<- prometheus.Metric) { n.c.sendNeverSeen(ch) }
@@ -0,0 +1,115 @@
+package basic
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/config"
+)
+
+// sendDerived sends metrics computed from several CloudWatch metrics and instance metadata.
+// Must be called with s.m held after all metrics are scraped.
+func (s *Scraper) sendDerived() {
+	// metadata is still being loaded
+	if s.sessionInstance.ResourceID == "" {
+		return
+	}
+
+	utilization := make(map[string]float64) // health score component -> utilization percent
+
+	if v, ok := s.values["CPUUtilization"]; ok {
+		utilization["cpu"] = v
+	}
+	if v, ok := s.storageUtilization(); ok {
+		utilization["storage"] = v
+	}
+	if v, ok := s.iopsUtilization(); ok {
+		utilization["iops"] = v
+		s.ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				"rds_iops_utilization_percent",
+				"Total read and write IOPS as a percentage of provisioned IOPS. Units: Percent",
+				nil, s.constLabels,
+			),
+			prometheus.GaugeValue,
+			v,
+		)
+	}
+
+	if v, ok := s.values["ReplicaLag"]; ok {
+		if i := s.sessionInstance; i.ReplicaSourceRegion != "" && i.ReplicaSourceRegion != i.Region {
+			s.ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					"rds_cross_region_replica_lag_seconds",
+					"The amount of time a cross-region read replica lags behind the source instance. Unit: Seconds",
+					[]string{"source", "replica"}, s.constLabels,
+				),
+				prometheus.GaugeValue,
+				v,
+				i.ReplicaSourceRegion+"/"+i.ReplicaSourceInstance, i.Region+"/"+i.Instance,
+			)
+		}
+	}
+
+	if hs := s.collector.config.HealthScore; hs != nil {
+		if v, ok := healthScore(hs, utilization); ok {
+			s.ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					"rds_instance_health_score",
+					"Heuristic instance health score from 0 (worst) to 100 (best): 100 minus weighted average of utilization percentages.",
+					nil, s.constLabels,
+				),
+				prometheus.GaugeValue,
+				v,
+			)
+		}
+	}
+}
+
+// iopsUtilization returns total IOPS utilization for instances with provisioned IOPS (io1, io2, gp3).
+func (s *Scraper) iopsUtilization() (float64, bool) {
+	if s.sessionInstance.Iops <= 0 {
+		return 0, false
+	}
+	read, ok := s.values["ReadIOPS"]
+	if !ok {
+		return 0, false
+	}
+	write, ok := s.values["WriteIOPS"]
+	if !ok {
+		return 0, false
+	}
+	return (read + write) / float64(s.sessionInstance.Iops) * 100, true
+}
+
+// storageUtilization returns used storage percentage for instances with allocated storage.
+// Aurora storage grows automatically, so it is not used for them.
+func (s *Scraper) storageUtilization() (float64, bool) {
+	if s.sessionInstance.AllocatedStorage <= 0 || s.sessionInstance.StorageType == "aurora" {
+		return 0, false
+	}
+	free, ok := s.values["FreeStorageSpace"]
+	if !ok {
+		return 0, false
+	}
+	total := float64(s.sessionInstance.AllocatedStorage) * 1024 * 1024 * 1024
+	return (total - free) / total * 100, true
+}
+
+// healthScore returns 100 minus weighted average of available utilization percentages.
+// It returns false if no components with non-zero weight are available.
+// Memory and connections are not used: their limits (instance class memory, max_connections)
+// are not known from CloudWatch and DescribeDBInstances, so IOPS utilization is used instead.
+func healthScore(hs *config.HealthScore, utilization map[string]float64) (float64, bool) {
+	var sum, weights float64
+	for component, v := range utilization {
+		w := hs.Weight(component)
+		sum += w * math.Min(math.Max(v, 0), 100)
+		weights += w
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return 100 - sum/weights, true
+}
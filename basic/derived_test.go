@@ -0,0 +1,28 @@
+package basic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/percona/rds_exporter/config"
+)
+
+func TestHealthScore(t *testing.T) {
+	utilization := map[string]float64{
+		"cpu":     40,
+		"storage": 80,
+		"iops":    120, // saturated
+	}
+
+	v, ok := healthScore(&config.HealthScore{}, utilization)
+	assert.True(t, ok)
+	assert.InDelta(t, 100-(40+80+100)/3.0, v, 1e-9)
+
+	v, ok = healthScore(&config.HealthScore{Weights: map[string]float64{"cpu": 3, "storage": 1}}, utilization)
+	assert.True(t, ok)
+	assert.InDelta(t, 100-(3*40+80)/4.0, v, 1e-9)
+
+	_, ok = healthScore(&config.HealthScore{Weights: map[string]float64{"iops": 1}}, map[string]float64{"cpu": 40})
+	assert.False(t, ok)
+}
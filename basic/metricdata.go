@@ -0,0 +1,171 @@
+package basic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/go-kit/log/level"
+)
+
+// UseGetMetricData makes scrapers request all instance's metrics with batched GetMetricData calls
+// instead of one GetMetricStatistics call per metric.
+var UseGetMetricData = false
+
+// maxMetricDataQueries is a maximum number of queries in a single GetMetricData request.
+const maxMetricDataQueries = 500
+
+// metricDataQuery identifies a single query of GetMetricData batch.
+type metricDataQuery struct {
+	metric    int    // index of metric in batch
+	statistic string // statistic like "Average" or extended statistic like "p99"
+}
+
+// scrapeMetricData scrapes all metrics with batched GetMetricData calls.
+// Metrics that need datapoint units are scraped with GetMetricStatistics, because GetMetricData does not return them.
+func (s *Scraper) scrapeMetricData() {
+	var batched, other []Metric
+	for _, metric := range s.metrics {
+		switch {
+		case s.skipMetric(metric):
+			continue
+		case metric.ratio:
+			other = append(other, metric)
+		default:
+			batched = append(batched, metric)
+		}
+	}
+
+	for _, batch := range splitBatches(batched, maxMetricDataQueries) {
+		err := s.scrapeBatch(batch)
+		switch {
+		case err == nil:
+			continue
+		case invalidMetricError(err):
+			// find out which metrics are invalid
+			s.collector.mInstanceAPIErrors.WithLabelValues(s.instance.Region, s.instance.Instance, "GetMetricData").Inc()
+			level.Warn(s.collector.l).Log("msg", fmt.Sprintf("GetMetricData request for %s is invalid, falling back to GetMetricStatistics.", s.instance), "error", err)
+			other = append(other, batch...)
+		default:
+			s.handleError("GetMetricData", err)
+			for _, metric := range batch {
+				s.sendStale(metric)
+			}
+		}
+	}
+
+	s.scrapeMetricStatistics(other)
+}
+
+// splitBatches splits metrics into batches with at most max queries each.
+func splitBatches(metrics []Metric, max int) [][]Metric {
+	var res [][]Metric
+	var queries int
+	for i, start := 0, 0; i < len(metrics); i++ {
+		n := len(metrics[i].requestedStatistics()) + len(metrics[i].extendedStatistics)
+		if queries+n > max && i > start {
+			res = append(res, metrics[start:i])
+			start, queries = i, 0
+		}
+		queries += n
+		if i == len(metrics)-1 {
+			res = append(res, metrics[start:])
+		}
+	}
+	return res
+}
+
+// scrapeBatch requests metrics with a single GetMetricData call (with pagination) and sends their values.
+func (s *Scraper) scrapeBatch(batch []Metric) error {
+	queries := make(map[string]metricDataQuery)
+	input := &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(s.start),
+		EndTime:   aws.Time(s.end),
+	}
+	for i, metric := range batch {
+		for j, statistic := range append(metric.requestedStatistics(), metric.extendedStatistics...) {
+			// IDs should start with a lowercase letter
+			id := fmt.Sprintf("m%d_%d", i, j)
+			queries[id] = metricDataQuery{metric: i, statistic: statistic}
+			input.MetricDataQueries = append(input.MetricDataQueries, &cloudwatch.MetricDataQuery{
+				Id: aws.String(id),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String("AWS/RDS"),
+						MetricName: aws.String(metric.cwName),
+						Dimensions: s.dimensions(metric),
+					},
+					Period: aws.Int64(int64(s.period.Seconds())),
+					Stat:   aws.String(statistic),
+				},
+			})
+		}
+	}
+
+	datapoints := make([]map[time.Time]*cloudwatch.Datapoint, len(batch))
+	err := s.svc.GetMetricDataPagesWithContext(s.ctx, input, func(page *cloudwatch.GetMetricDataOutput, _ bool) bool {
+		for _, r := range page.MetricDataResults {
+			q, ok := queries[aws.StringValue(r.Id)]
+			if !ok {
+				continue
+			}
+			if datapoints[q.metric] == nil {
+				datapoints[q.metric] = make(map[time.Time]*cloudwatch.Datapoint)
+			}
+			addMetricDataResult(datapoints[q.metric], q.statistic, r)
+		}
+		return true
+	})
+	if err != nil {
+		return &apiError{api: "GetMetricData", err: err}
+	}
+
+	for i, metric := range batch {
+		dps := make([]*cloudwatch.Datapoint, 0, len(datapoints[i]))
+		for _, dp := range datapoints[i] {
+			// the same as GetMetricStatistics datapoints, which always have requested average
+			if dp.Average != nil {
+				dps = append(dps, dp)
+			}
+		}
+		if err := s.handleDatapoints(metric, dps); err != nil {
+			s.handleError(metric.cwName, err)
+		}
+	}
+	return nil
+}
+
+// addMetricDataResult merges values of a single statistic into datapoints by timestamp.
+func addMetricDataResult(datapoints map[time.Time]*cloudwatch.Datapoint, statistic string, r *cloudwatch.MetricDataResult) {
+	for i, ts := range r.Timestamps {
+		if i >= len(r.Values) {
+			break
+		}
+
+		t := aws.TimeValue(ts)
+		dp := datapoints[t]
+		if dp == nil {
+			dp = &cloudwatch.Datapoint{Timestamp: aws.Time(t)}
+			datapoints[t] = dp
+		}
+
+		switch statistic {
+		case "Average":
+			dp.Average = r.Values[i]
+		case "Minimum":
+			dp.Minimum = r.Values[i]
+		case "Maximum":
+			dp.Maximum = r.Values[i]
+		case "Sum":
+			dp.Sum = r.Values[i]
+		case "SampleCount":
+			dp.SampleCount = r.Values[i]
+		default:
+			if dp.ExtendedStatistics == nil {
+				dp.ExtendedStatistics = make(map[string]*float64)
+			}
+			dp.ExtendedStatistics[statistic] = r.Values[i]
+		}
+	}
+}
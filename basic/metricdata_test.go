@@ -0,0 +1,46 @@
+package basic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBatches(t *testing.T) {
+	metrics := []Metric{
+		{cwName: "A"},
+		{cwName: "B", extendedStatistics: []string{"p95", "p99"}},
+		{cwName: "C"},
+		{cwName: "D"},
+	}
+
+	assert.Nil(t, splitBatches(nil, 3))
+	assert.Equal(t, [][]Metric{metrics}, splitBatches(metrics, 500))
+	assert.Equal(t, [][]Metric{metrics[:1], metrics[1:2], metrics[2:]}, splitBatches(metrics, 3))
+
+	// metric with more queries than limit is still requested
+	assert.Equal(t, [][]Metric{metrics[:1], metrics[1:2], metrics[2:3], metrics[3:]}, splitBatches(metrics, 1))
+}
+
+func TestAddMetricDataResult(t *testing.T) {
+	t1 := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	datapoints := make(map[time.Time]*cloudwatch.Datapoint)
+	addMetricDataResult(datapoints, "Average", &cloudwatch.MetricDataResult{
+		Timestamps: []*time.Time{aws.Time(t2), aws.Time(t1)},
+		Values:     []*float64{aws.Float64(2), aws.Float64(1)},
+	})
+	addMetricDataResult(datapoints, "p99", &cloudwatch.MetricDataResult{
+		Timestamps: []*time.Time{aws.Time(t2)},
+		Values:     []*float64{aws.Float64(20)},
+	})
+
+	assert.Equal(t, map[time.Time]*cloudwatch.Datapoint{
+		t1: {Timestamp: aws.Time(t1), Average: aws.Float64(1)},
+		t2: {Timestamp: aws.Time(t2), Average: aws.Float64(2), ExtendedStatistics: map[string]*float64{"p99": aws.Float64(20)}},
+	}, datapoints)
+}
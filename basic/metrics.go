@@ -252,3 +252,45 @@ var Metrics = []Metric{
 		prometheusHelp: "The amount of time a read replica DB instance lags behind the source DB instance. Unit: Seconds",
 	},
 }
+
+// PostgreSQLMetrics are collected in addition to Metrics for PostgreSQL-compatible engines only.
+var PostgreSQLMetrics = []Metric{
+	{
+		cwName:         "OldestReplicationSlotLag",
+		prometheusName: "aws_rds_oldest_replication_slot_lag_average",
+		prometheusHelp: "The lagging size of the replica lagging the most in terms of WAL data received. Applies to PostgreSQL. Units: Bytes",
+	},
+	{
+		cwName:         "ReplicationSlotDiskUsage",
+		prometheusName: "aws_rds_replication_slot_disk_usage_average",
+		prometheusHelp: "The disk space used by replication slot files. Applies to PostgreSQL. Units: Bytes",
+	},
+	{
+		cwName:         "TransactionLogsDiskUsage",
+		prometheusName: "aws_rds_transaction_logs_disk_usage_average",
+		prometheusHelp: "The disk space used by transaction logs not yet removed, for example, because of lagging replicas. Applies to PostgreSQL. Units: Bytes",
+	},
+}
+
+// AuroraMySQLMetrics are collected in addition to Metrics for Aurora MySQL engines only.
+// They are published by CloudWatch per cluster, so values are the same for all cluster's instances.
+var AuroraMySQLMetrics = []Metric{
+	{
+		cwName:           "BacktrackChangeRecordsStored",
+		prometheusName:   "aws_rds_backtrack_change_records_stored_average",
+		prometheusHelp:   "The number of backtrack change records used by the DB cluster. Applies to Aurora MySQL with backtracking enabled. Units: Count",
+		clusterDimension: true,
+	},
+	{
+		cwName:           "BacktrackWindowActual",
+		prometheusName:   "aws_rds_backtrack_window_actual_average",
+		prometheusHelp:   "The difference between the target backtrack window and the actual backtrack window. Applies to Aurora MySQL with backtracking enabled. Units: Minutes",
+		clusterDimension: true,
+	},
+	{
+		cwName:           "BacktrackWindowAlert",
+		prometheusName:   "aws_rds_backtrack_window_alert_average",
+		prometheusHelp:   "The number of times that the actual backtrack window is smaller than the target backtrack window for a given period of time. Applies to Aurora MySQL with backtracking enabled. Units: Count",
+		clusterDimension: true,
+	},
+}
@@ -0,0 +1,93 @@
+package basic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prefetcher collects metrics from the wrapped collector in background and serves the latest complete snapshot,
+// so Prometheus scrapes are not blocked by CloudWatch latency.
+type Prefetcher struct {
+	c prometheus.Collector
+	l log.Logger
+
+	rw       sync.RWMutex
+	snapshot []prometheus.Metric
+}
+
+// NewPrefetcher creates a new Prefetcher for the given collector.
+func NewPrefetcher(c prometheus.Collector, logger log.Logger) *Prefetcher {
+	return &Prefetcher{
+		c: c,
+		l: log.With(logger, "component", "prefetch"),
+	}
+}
+
+// Run collects a new snapshot every interval until context is canceled.
+// Collection of the next snapshot starts lead before the current one becomes interval old,
+// so it is swapped in on time; lead should be close to the usual collection duration.
+func (p *Prefetcher) Run(ctx context.Context, interval, lead time.Duration) {
+	for {
+		start := time.Now()
+		p.prefetch()
+		level.Debug(p.l).Log("msg", "Snapshot collected.", "duration", time.Since(start))
+
+		wait := interval - lead
+		if wait < 0 {
+			wait = 0
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+			// nothing
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// prefetch collects a new snapshot while the current one is being served, then swaps them.
+func (p *Prefetcher) prefetch() {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		p.c.Collect(ch)
+		close(ch)
+	}()
+
+	var snapshot []prometheus.Metric
+	for m := range ch {
+		snapshot = append(snapshot, m)
+	}
+
+	p.rw.Lock()
+	p.snapshot = snapshot
+	p.rw.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (p *Prefetcher) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+// Nothing is sent until the first snapshot is collected.
+func (p *Prefetcher) Collect(ch chan<- prometheus.Metric) {
+	p.rw.RLock()
+	snapshot := p.snapshot
+	p.rw.RUnlock()
+
+	for _, m := range snapshot {
+		ch <- m
+	}
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Prefetcher)(nil)
+)
@@ -0,0 +1,38 @@
+package basic
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCollector sends the number of Collect calls.
+type countingCollector struct {
+	calls int64
+}
+
+func (c *countingCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *countingCollector) Collect(ch chan<- prometheus.Metric) {
+	v := atomic.AddInt64(&c.calls, 1)
+	ch <- prometheus.MustNewConstMetric(prometheus.NewDesc("test_calls", "Test.", nil, nil), prometheus.GaugeValue, float64(v))
+}
+
+func TestPrefetcher(t *testing.T) {
+	c := new(countingCollector)
+	p := NewPrefetcher(c, promlog.New(&promlog.Config{}))
+
+	assert.Equal(t, 0, testutil.CollectAndCount(p))
+
+	p.prefetch()
+	assert.Equal(t, 1.0, testutil.ToFloat64(p))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p), "snapshot should be served without collecting")
+
+	p.prefetch()
+	assert.Equal(t, 2.0, testutil.ToFloat64(p))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&c.calls))
+}
@@ -1,21 +1,42 @@
 package basic
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
 )
 
 var (
+	// Default CloudWatch request window; can be overridden per instance.
 	Period = 60 * time.Second
 	Delay  = 600 * time.Second
 	Range  = 600 * time.Second
+
+	// CloudWatchTimestamps enables sending metrics with CloudWatch datapoints timestamps instead of scrape time.
+	CloudWatchTimestamps = false
+
+	// ScrapeTimeout limits duration of a single basic metrics collection; 0 means no limit.
+	// Requests that are still running when it expires are canceled.
+	ScrapeTimeout time.Duration
+
+	// PredictStorageFull enables rds_predicted_storage_full_seconds metric computed from FreeStorageSpace trend.
+	PredictStorageFull = false
 )
 
 type Scraper struct {
@@ -25,29 +46,37 @@ type Scraper struct {
 	ch        chan<- prometheus.Metric
 
 	// internal
-	svc         *cloudwatch.CloudWatch
-	constLabels prometheus.Labels
+	ctx             context.Context
+	cancel          context.CancelFunc
+	sessionInstance *sessions.Instance
+	svc             cloudwatchiface.CloudWatchAPI
+	constLabels     prometheus.Labels
+	metrics         []Metric
+	start, end      time.Time     // queried window, the same for all metrics
+	period          time.Duration // Period or instance's one adjusted to instance's resolution
+	delay, rng      time.Duration // Delay and Range or instance's ones
+
+	m       sync.Mutex
+	values  map[string]float64 // metricKey -> latest average value in the current scrape
+	invalid []string           // CloudWatch metric names rejected by CloudWatch as invalid in the current scrape
+	errors  int                // number of failed metric requests in the current scrape
+	lastErr error              // the last of them
 }
 
-func NewScraper(instance *config.Instance, collector *Collector, ch chan<- prometheus.Metric) *Scraper {
+func NewScraper(ctx context.Context, instance *config.Instance, collector *Collector, ch chan<- prometheus.Metric) *Scraper {
 	// Create CloudWatch client
-	sess, _ := collector.sessions.GetSession(instance.Region, instance.Instance)
+	sess, sessionInstance := collector.sessions.GetSession(instance.Region, instance.Instance)
 	if sess == nil {
 		return nil
 	}
-	svc := cloudwatch.New(sess)
-
-	constLabels := prometheus.Labels{
-		"region":   instance.Region,
-		"instance": instance.Instance,
-	}
-	for n, v := range instance.Labels {
-		if v == "" {
-			delete(constLabels, n)
-		} else {
-			constLabels[n] = v
-		}
+	svc, err := newCloudWatch(sess, instance)
+	if err != nil {
+		level.Error(collector.l).Log("msg", fmt.Sprintf("Can't use FIPS endpoint for %s.", instance), "error", err)
+		return nil
 	}
+	collector.countRequests(svc, instance.Region)
+	ctx, cancel := context.WithCancel(ctx)
+	period, delay, rng := scrapeWindow(instance)
 
 	return &Scraper{
 		// params
@@ -56,9 +85,44 @@ func NewScraper(instance *config.Instance, collector *Collector, ch chan<- prome
 		ch:        ch,
 
 		// internal
-		svc:         svc,
-		constLabels: constLabels,
+		ctx:             ctx,
+		cancel:          cancel,
+		sessionInstance: sessionInstance,
+		svc:             svc,
+		constLabels:     sessionInstance.ConstLabels(),
+		metrics:         collector.metricsFor(sessionInstance.Engine),
+		period:          period,
+		delay:           delay,
+		rng:             rng,
+		values:          make(map[string]float64),
+	}
+}
+
+// countRequests makes collector count all requests (including retries) sent by CloudWatch client.
+func (c *Collector) countRequests(svc *cloudwatch.CloudWatch, region string) {
+	svc.Handlers.Send.PushBack(func(r *request.Request) {
+		c.mCloudWatchRequests.WithLabelValues(region, r.Operation.Name).Inc()
+	})
+}
+
+// newCloudWatch returns CloudWatch client for the instance's session.
+// Without use_fips and cloudwatch_endpoint options the default AWS endpoint of session's region is used.
+func newCloudWatch(sess *session.Session, instance *config.Instance) (*cloudwatch.CloudWatch, error) {
+	awsCfg := aws.NewConfig()
+	if instance.UseFIPS {
+		endpoint, err := config.CloudWatchFIPSEndpoint(instance.Region)
+		if err != nil {
+			return nil, err
+		}
+		awsCfg = awsCfg.WithEndpoint(endpoint)
+	}
+	if instance.CloudWatchEndpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(instance.CloudWatchEndpoint)
 	}
+	if instance.CloudWatchRegion != "" {
+		awsCfg = awsCfg.WithRegion(instance.CloudWatchRegion)
+	}
+	return cloudwatch.New(sess, awsCfg), nil
 }
 
 func getLatestDatapoint(datapoints []*cloudwatch.Datapoint) *cloudwatch.Datapoint {
@@ -76,71 +140,514 @@ func getLatestDatapoint(datapoints []*cloudwatch.Datapoint) *cloudwatch.Datapoin
 // Scrape makes the required calls to AWS CloudWatch by using the parameters in the Collector.
 // Once converted into Prometheus format, the metrics are pushed on the ch channel.
 func (s *Scraper) Scrape() {
-	var wg sync.WaitGroup
-	defer wg.Wait()
+	defer s.cancel()
+
+	s.end = time.Now().Add(-s.delay)
+	s.start = s.end.Add(-s.rng)
+
+	if UseGetMetricData {
+		s.scrapeMetricData()
+	} else {
+		s.scrapeMetricStatistics(s.metrics)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.sendDerived()
+	s.collector.observeMetrics(s.metrics, s.values)
+
+	// failed requests do not mean that instance has no datapoints
+	cold := s.collector.cold.observe(s.instance.Region+"/"+s.instance.Instance, len(s.values) == 0 && s.errors == 0)
+	if ColdThreshold > 0 {
+		s.sendCold(cold)
+	}
+
+	// Send coverage summary.
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_exporter_instance_metrics_configured",
+			"Number of basic metrics configured for the instance.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		float64(len(s.metrics)),
+	)
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_exporter_instance_metrics_collected",
+			"Number of basic metrics that returned a datapoint for the instance in the last scrape.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		float64(len(s.values)),
+	)
+
+	// Send invalid metrics configurations.
+	for _, name := range s.invalid {
+		s.ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				"rds_exporter_invalid_metric_config",
+				"1 if CloudWatch rejected the metric request as invalid (bad metric, dimension, or statistic combination).",
+				[]string{"metric"}, s.constLabels,
+			),
+			prometheus.GaugeValue,
+			1,
+			name,
+		)
+	}
+
+	// Send effective period and queried window.
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_exporter_effective_period_seconds",
+			"Period of CloudWatch datapoints requested for the instance, adjusted to its resolution.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		s.period.Seconds(),
+	)
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_exporter_query_window_start_timestamp_seconds",
+			"Start of the time window queried from CloudWatch in the last scrape.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		float64(s.start.UnixNano())/1e9,
+	)
+	s.ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			"rds_exporter_query_window_end_timestamp_seconds",
+			"End of the time window queried from CloudWatch in the last scrape.",
+			nil, s.constLabels,
+		),
+		prometheus.GaugeValue,
+		float64(s.end.UnixNano())/1e9,
+	)
+}
 
-	wg.Add(len(s.collector.metrics))
-	for _, metric := range s.collector.metrics {
+// scrapeMetricStatistics scrapes given metrics concurrently with one GetMetricStatistics call per metric.
+func (s *Scraper) scrapeMetricStatistics(metrics []Metric) {
+	var wg sync.WaitGroup
+	wg.Add(len(metrics))
+	for _, metric := range metrics {
 		metric := metric
 		go func() {
 			defer wg.Done()
+			defer s.collector.recoverRegion(s.instance.Region, s.cancel)
 
 			if err := s.scrapeMetric(metric); err != nil {
-				level.Error(s.collector.l).Log("metric", metric.cwName, "error", err)
+				s.handleError(metric.cwName, err)
 			}
 		}()
 	}
+	wg.Wait()
+}
+
+// handleError accounts and logs an error of metric (or batch of metrics) request.
+func (s *Scraper) handleError(name string, err error) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		s.collector.mInstanceAPIErrors.WithLabelValues(s.instance.Region, s.instance.Instance, apiErr.api).Inc()
+	}
+
+	s.m.Lock()
+	if invalidMetricError(err) {
+		s.invalid = append(s.invalid, name)
+	}
+	s.errors++
+	s.lastErr = fmt.Errorf("%s: %w", name, err)
+	s.m.Unlock()
+
+	level.Error(s.collector.l).Log("metric", name, "error", err)
+}
+
+// state returns the result of finished scrape started at the given time.
+func (s *Scraper) state(start time.Time) ScrapeState {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	res := ScrapeState{
+		Time:      start,
+		Duration:  time.Since(start).String(),
+		Status:    "ok",
+		Collected: len(s.values),
+		Errors:    s.errors,
+	}
+	if s.lastErr != nil {
+		res.Status = "error"
+		res.LastError = s.lastErr.Error()
+	}
+	return res
 }
 
 func (s *Scraper) scrapeMetric(metric Metric) error {
-	now := time.Now()
-	end := now.Add(-Delay)
+	if s.skipMetric(metric) {
+		return nil
+	}
 
 	params := &cloudwatch.GetMetricStatisticsInput{
-		EndTime:   aws.Time(end),
-		StartTime: aws.Time(end.Add(-Range)),
+		EndTime:   aws.Time(s.end),
+		StartTime: aws.Time(s.start),
 
-		Period:     aws.Int64(int64(Period.Seconds())),
+		Period:     aws.Int64(int64(s.period.Seconds())),
 		MetricName: aws.String(metric.cwName),
 		Namespace:  aws.String("AWS/RDS"),
-		Dimensions: []*cloudwatch.Dimension{},
-		Statistics: aws.StringSlice([]string{"Average"}),
+		Dimensions: s.dimensions(metric),
+		Statistics: aws.StringSlice(metric.requestedStatistics()),
 		Unit:       nil,
 	}
-
-	params.Dimensions = append(params.Dimensions, &cloudwatch.Dimension{
-		Name:  aws.String("DBInstanceIdentifier"),
-		Value: aws.String(s.instance.Instance),
-	})
+	if len(metric.extendedStatistics) > 0 {
+		params.ExtendedStatistics = aws.StringSlice(metric.extendedStatistics)
+	}
 
 	// Call CloudWatch to gather the datapoints
-	resp, err := s.svc.GetMetricStatistics(params)
+	resp, err := s.svc.GetMetricStatisticsWithContext(s.ctx, params)
 	if err != nil {
+		err = &apiError{api: "GetMetricStatistics", err: err}
+		if !invalidMetricError(err) {
+			s.sendStale(metric)
+		}
 		return err
 	}
 
+	return s.handleDatapoints(metric, resp.Datapoints)
+}
+
+// skipMetric returns true if metric can't be requested for the instance now.
+func (s *Scraper) skipMetric(metric Metric) bool {
+	// cluster is not known until instance metadata is loaded
+	return metric.clusterDimension && s.sessionInstance.ClusterIdentifier == ""
+}
+
+// handleDatapoints sends metric values from CloudWatch datapoints of the requested range.
+func (s *Scraper) handleDatapoints(metric Metric, datapoints []*cloudwatch.Datapoint) error {
 	// There's nothing in there, don't publish the metric
-	if len(resp.Datapoints) == 0 {
+	if len(datapoints) == 0 {
 		return nil
 	}
 
-	// Pick the latest datapoint
-	dp := getLatestDatapoint(resp.Datapoints)
+	// Pick the latest datapoint once, so all statistics are consistent.
+	dp := getLatestDatapoint(datapoints)
+	s.collector.lastDatapoints.store(s.datapointKey(metric), dp, time.Now())
+	s.m.Lock()
+	s.values[metricKey(metric)] = aws.Float64Value(dp.Average)
+	s.m.Unlock()
 
-	// Get the metric.
-	v := aws.Float64Value(dp.Average)
-	switch metric.cwName {
-	case "EngineUptime":
-		// "Fake EngineUptime -> node_boot_time with time.Now().Unix() - EngineUptime."
-		v = float64(time.Now().Unix() - int64(v))
+	if metric.ratio && aws.StringValue(dp.Unit) == cloudwatch.StandardUnitPercent {
+		metric = ratioMetric(metric)
+	}
+
+	for _, sv := range datapointValues(metric, dp) {
+		s.sendStatistic(metric, sv, aws.TimeValue(dp.Timestamp))
+	}
+
+	if metric.cwName == "FreeStorageSpace" && PredictStorageFull {
+		s.predictStorageFull(datapoints, dp)
+	}
+
+	if metric.stddev {
+		if v, ok := stddev(datapoints); ok {
+			s.ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(baseName(metric)+"_stddev", metric.prometheusHelp+" (standard deviation over the requested range)", nil, s.labels(metric)),
+				prometheus.GaugeValue,
+				v*math.Abs(metric.scaleFactor()),
+			)
+		}
 	}
 
-	// Send metric.
+	if metric.anomalyBand {
+		if err := s.scrapeAnomalyBand(metric); err != nil {
+			return fmt.Errorf("anomaly band: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// apiError is an error returned by AWS API call.
+type apiError struct {
+	api string // for example, "GetMetricStatistics"
+	err error
+}
+
+func (e *apiError) Error() string { return e.api + ": " + e.err.Error() }
+func (e *apiError) Unwrap() error { return e.err }
+
+// invalidMetricError returns true if CloudWatch error is caused by invalid request parameters
+// rather than by a transient problem.
+func invalidMetricError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	switch awsErr.Code() {
+	case "InvalidParameterValue", "InvalidParameterCombination", "MissingParameter":
+		return true
+	default:
+		return false
+	}
+}
+
+// dimensions returns CloudWatch dimensions for the given metric of the instance.
+func (s *Scraper) dimensions(metric Metric) []*cloudwatch.Dimension {
+	if metric.clusterDimension {
+		return []*cloudwatch.Dimension{{
+			Name:  aws.String("DBClusterIdentifier"),
+			Value: aws.String(s.sessionInstance.ClusterIdentifier),
+		}}
+	}
+
+	res := []*cloudwatch.Dimension{{
+		Name:  aws.String("DBInstanceIdentifier"),
+		Value: aws.String(s.instance.Instance),
+	}}
+	for name, value := range metric.dimensions {
+		res = append(res, &cloudwatch.Dimension{
+			Name:  aws.String(name),
+			Value: aws.String(value),
+		})
+	}
+	return res
+}
+
+// labels returns constant labels for the given metric of the instance, including ones for extra dimensions
+// and stale label.
+func (s *Scraper) labels(metric Metric) prometheus.Labels {
+	if len(metric.dimensions) == 0 && !metric.stale {
+		return s.constLabels
+	}
+
+	res := make(prometheus.Labels, len(s.constLabels)+len(metric.dimensions)+1)
+	for n, v := range s.constLabels {
+		res[n] = v
+	}
+	for n, v := range metric.dimensions {
+		res[config.SnakeCase(n)] = sessions.LimitLabelValue(v)
+	}
+	if metric.stale {
+		res["stale"] = "true"
+	}
+	return res
+}
+
+// statisticValue is a converted value of a single CloudWatch statistic.
+type statisticValue struct {
+	statistic string // statistic like "Average" or extended statistic like "p99"
+	value     float64
+}
+
+// datapointValues returns values of all requested statistics present in a single datapoint.
+func datapointValues(metric Metric, dp *cloudwatch.Datapoint) []statisticValue {
+	res := make([]statisticValue, 0, len(metric.sentStatistics())+len(metric.extendedStatistics))
+	for _, st := range metric.sentStatistics() {
+		if v := statistic(dp, st); v != nil {
+			res = append(res, statisticValue{st, convertValue(metric, *v)})
+		}
+	}
+	for _, p := range metric.extendedStatistics {
+		if v := dp.ExtendedStatistics[p]; v != nil {
+			res = append(res, statisticValue{p, convertValue(metric, *v)})
+		}
+	}
+	return res
+}
+
+// statistic returns value of the given CloudWatch statistic (not extended one) in datapoint, or nil.
+func statistic(dp *cloudwatch.Datapoint, name string) *float64 {
+	switch name {
+	case "Average":
+		return dp.Average
+	case "Minimum":
+		return dp.Minimum
+	case "Maximum":
+		return dp.Maximum
+	case "Sum":
+		return dp.Sum
+	case "SampleCount":
+		return dp.SampleCount
+	default:
+		return nil
+	}
+}
+
+// standardStatistic returns true for CloudWatch statistics like "Maximum", and false for extended ones like "p99".
+func standardStatistic(statistic string) bool {
+	for _, s := range config.Statistics {
+		if s == statistic {
+			return true
+		}
+	}
+	return false
+}
+
+// sendStatistic sends a single statistic value of datapoint with given timestamp unless it is filtered out.
+func (s *Scraper) sendStatistic(metric Metric, sv statisticValue, timestamp time.Time) {
+	if metric.filtered(sv.value) {
+		return
+	}
+
+	constLabels := s.labels(metric)
+
+	var desc *prometheus.Desc
+	var labelValues []string
+	switch {
+	case sv.statistic == "Average":
+		desc = prometheus.NewDesc(metric.prometheusName, metric.prometheusHelp, nil, constLabels)
+	case standardStatistic(sv.statistic):
+		// other statistics as separate metrics with suffixes like "_maximum"
+		desc = prometheus.NewDesc(baseName(metric)+"_"+config.SnakeCase(sv.statistic), metric.prometheusHelp, nil, constLabels)
+	case metric.percentileSuffix:
+		// percentiles as separate metrics
+		desc = prometheus.NewDesc(baseName(metric)+"_"+strings.ReplaceAll(sv.statistic, ".", "_"), metric.prometheusHelp, nil, constLabels)
+	default:
+		// percentiles as plain gauges with quantile label
+		desc = prometheus.NewDesc(baseName(metric)+"_percentile", metric.prometheusHelp, []string{"quantile"}, constLabels)
+		labelValues = []string{quantile(sv.statistic)}
+	}
+
+	m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, sv.value, labelValues...)
+	if CloudWatchTimestamps && !timestamp.IsZero() {
+		m = prometheus.NewMetricWithTimestamp(timestamp, m)
+	}
+	s.ch <- m
+}
+
+// predictStorageFull sends estimated time until storage is full at the current rate
+// from the linear trend of FreeStorageSpace datapoints over the whole range.
+func (s *Scraper) predictStorageFull(datapoints []*cloudwatch.Datapoint, latest *cloudwatch.Datapoint) {
+	slope, ok := linearSlope(datapoints)
+	if !ok {
+		return
+	}
+
+	v := math.Inf(1)
+	if slope < 0 {
+		v = aws.Float64Value(latest.Average) / -slope
+	}
 	s.ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc(metric.prometheusName, metric.prometheusHelp, nil, s.constLabels),
+		prometheus.NewDesc(
+			"rds_predicted_storage_full_seconds",
+			"Estimated time until storage is full at the current FreeStorageSpace rate; +Inf if it is not decreasing.",
+			nil, s.constLabels,
+		),
 		prometheus.GaugeValue,
 		v,
 	)
+}
 
-	return nil
+// scrapeWindow returns CloudWatch request window for the instance: period adjusted to its resolution, delay, and range.
+// Package defaults are used for fields not set in instance's configuration.
+func scrapeWindow(instance *config.Instance) (period, delay, rng time.Duration) {
+	period, delay, rng = Period, Delay, Range
+	if instance.Period > 0 {
+		period = instance.Period
+	}
+	if instance.Delay != nil {
+		delay = *instance.Delay
+	}
+	if instance.Range > 0 {
+		rng = instance.Range
+	}
+	return effectivePeriod(period, instance.Resolution), delay, rng
+}
+
+// effectivePeriod returns period increased to a multiple of resolution.
+// Zero resolution means that metrics are published every minute.
+func effectivePeriod(period, resolution time.Duration) time.Duration {
+	if resolution <= 0 {
+		resolution = time.Minute
+	}
+	if period <= resolution {
+		return resolution
+	}
+	if r := period % resolution; r != 0 {
+		period += resolution - r
+	}
+	return period
+}
+
+// stddev returns population standard deviation of datapoints averages.
+// It returns false if there are not enough datapoints.
+func stddev(datapoints []*cloudwatch.Datapoint) (float64, bool) {
+	if len(datapoints) < 2 {
+		return 0, false
+	}
+
+	var sum float64
+	for _, dp := range datapoints {
+		sum += aws.Float64Value(dp.Average)
+	}
+	mean := sum / float64(len(datapoints))
+
+	var sq float64
+	for _, dp := range datapoints {
+		d := aws.Float64Value(dp.Average) - mean
+		sq += d * d
+	}
+	return math.Sqrt(sq / float64(len(datapoints))), true
+}
+
+// linearSlope returns least squares slope of datapoints averages in units per second.
+// It returns false if there are not enough datapoints.
+func linearSlope(datapoints []*cloudwatch.Datapoint) (float64, bool) {
+	if len(datapoints) < 2 {
+		return 0, false
+	}
+
+	// use offsets from the first timestamp to avoid precision loss
+	t0 := aws.TimeValue(datapoints[0].Timestamp)
+	var sumX, sumY, sumXY, sumXX float64
+	for _, dp := range datapoints {
+		x := aws.TimeValue(dp.Timestamp).Sub(t0).Seconds()
+		y := aws.Float64Value(dp.Average)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(datapoints))
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / d, true
+}
+
+// baseName returns Prometheus metric name without statistic suffix.
+func baseName(metric Metric) string {
+	return strings.TrimSuffix(metric.prometheusName, "_average")
+}
+
+// convertValue converts CloudWatch value to Prometheus one.
+func convertValue(metric Metric, v float64) float64 {
+	switch metric.cwName {
+	case "EngineUptime":
+		// "Fake EngineUptime -> node_boot_time with time.Now().Unix() - EngineUptime."
+		v = float64(time.Now().Unix() - int64(v))
+	}
+	return v * metric.scaleFactor()
+}
+
+// quantile converts CloudWatch percentile statistic name (like "p99.9") to quantile label value (like "0.999").
+func quantile(statistic string) string {
+	p := strings.TrimPrefix(statistic, "p")
+	if p == "100" {
+		return "1"
+	}
+
+	intPart, fracPart := p, ""
+	if i := strings.IndexByte(p, '.'); i >= 0 {
+		intPart, fracPart = p[:i], p[i+1:]
+	}
+	if len(intPart) < 2 {
+		intPart = "0" + intPart
+	}
+	res := strings.TrimRight("0."+intPart+fracPart, "0")
+	if res == "0." {
+		return "0"
+	}
+	return res
 }
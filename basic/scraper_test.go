@@ -0,0 +1,486 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestQuantile(t *testing.T) {
+	for statistic, expected := range map[string]string{
+		"p0":     "0",
+		"p5":     "0.05",
+		"p50":    "0.5",
+		"p99":    "0.99",
+		"p99.9":  "0.999",
+		"p99.99": "0.9999",
+		"p100":   "1",
+	} {
+		assert.Equal(t, expected, quantile(statistic), statistic)
+	}
+}
+
+func TestLinearSlope(t *testing.T) {
+	now := time.Now()
+	datapoints := func(values ...float64) []*cloudwatch.Datapoint {
+		res := make([]*cloudwatch.Datapoint, len(values))
+		for i, v := range values {
+			// unordered, like CloudWatch returns them
+			res[len(values)-1-i] = &cloudwatch.Datapoint{
+				Timestamp: aws.Time(now.Add(time.Duration(i) * time.Minute)),
+				Average:   aws.Float64(v),
+			}
+		}
+		return res
+	}
+
+	slope, ok := linearSlope(datapoints(600, 480, 360, 240))
+	assert.True(t, ok)
+	assert.InDelta(t, -2, slope, 1e-9)
+
+	slope, ok = linearSlope(datapoints(100, 100, 100))
+	assert.True(t, ok)
+	assert.InDelta(t, 0, slope, 1e-9)
+
+	_, ok = linearSlope(datapoints(100))
+	assert.False(t, ok)
+}
+
+func TestEffectivePeriod(t *testing.T) {
+	assert.Equal(t, time.Minute, effectivePeriod(time.Minute, 0))
+	assert.Equal(t, time.Minute, effectivePeriod(time.Minute, time.Minute))
+	assert.Equal(t, 5*time.Minute, effectivePeriod(time.Minute, 5*time.Minute))
+	assert.Equal(t, 10*time.Minute, effectivePeriod(7*time.Minute, 5*time.Minute))
+	assert.Equal(t, 2*time.Minute, effectivePeriod(90*time.Second, 0))
+	assert.Equal(t, 10*time.Second, effectivePeriod(10*time.Second, 10*time.Second))
+}
+
+func TestScrapeWindow(t *testing.T) {
+	period, delay, rng := scrapeWindow(new(config.Instance))
+	assert.Equal(t, []time.Duration{Period, Delay, Range}, []time.Duration{period, delay, rng})
+
+	zero := time.Duration(0)
+	period, delay, rng = scrapeWindow(&config.Instance{Period: 2 * time.Minute, Delay: &zero, Range: time.Hour, Resolution: 5 * time.Minute})
+	assert.Equal(t, []time.Duration{5 * time.Minute, 0, time.Hour}, []time.Duration{period, delay, rng})
+}
+
+func TestStddev(t *testing.T) {
+	var datapoints []*cloudwatch.Datapoint
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		datapoints = append(datapoints, &cloudwatch.Datapoint{Average: aws.Float64(v)})
+	}
+	v, ok := stddev(datapoints)
+	assert.True(t, ok)
+	assert.InDelta(t, 2.0, v, 1e-9)
+
+	_, ok = stddev(datapoints[:1])
+	assert.False(t, ok)
+}
+
+func TestDatapointValues(t *testing.T) {
+	metric := Metric{
+		cwName:             "ReadLatency",
+		prometheusName:     "aws_rds_read_latency_average",
+		extendedStatistics: []string{"p50", "p99", "p99.9"},
+	}
+	dp := &cloudwatch.Datapoint{
+		Average: aws.Float64(0.002),
+		ExtendedStatistics: map[string]*float64{
+			"p50": aws.Float64(0.001),
+			"p99": aws.Float64(0.01),
+		},
+	}
+
+	expected := []statisticValue{
+		{"Average", 0.002},
+		{"p50", 0.001},
+		{"p99", 0.01},
+	}
+	assert.Equal(t, expected, datapointValues(metric, dp))
+}
+
+func TestStatistics(t *testing.T) {
+	metric := Metric{
+		cwName:         "FreeStorageSpace",
+		prometheusName: "aws_rds_free_storage_space_average",
+	}
+	assert.Equal(t, []string{"Average"}, metric.requestedStatistics())
+	assert.Equal(t, []string{"Average"}, metric.sentStatistics())
+
+	metric.statistics = []string{"Minimum", "Sum"}
+	assert.Equal(t, []string{"Average", "Minimum", "Sum"}, metric.requestedStatistics())
+	assert.Equal(t, []string{"Minimum", "Sum"}, metric.sentStatistics())
+
+	dp := &cloudwatch.Datapoint{
+		Average: aws.Float64(2),
+		Minimum: aws.Float64(1),
+		Sum:     aws.Float64(10),
+	}
+	assert.Equal(t, []statisticValue{{"Minimum", 1}, {"Sum", 10}}, datapointValues(metric, dp))
+
+	assert.True(t, standardStatistic("SampleCount"))
+	assert.False(t, standardStatistic("p99"))
+}
+
+func TestSendStatisticNaming(t *testing.T) {
+	send := func(metric Metric, sv statisticValue) string {
+		ch := make(chan prometheus.Metric, 1)
+		s := &Scraper{ch: ch, constLabels: prometheus.Labels{"instance": "db1"}}
+		s.sendStatistic(metric, sv, time.Time{})
+		return (<-ch).Desc().String()
+	}
+
+	for _, suffix := range []bool{false, true} {
+		metric := Metric{
+			cwName:           "ReadLatency",
+			prometheusName:   "aws_rds_read_latency_average",
+			percentileSuffix: suffix,
+		}
+
+		// standard statistics do not depend on naming scheme
+		assert.Contains(t, send(metric, statisticValue{"Average", 1}), `fqName: "aws_rds_read_latency_average"`)
+		assert.Contains(t, send(metric, statisticValue{"Maximum", 1}), `fqName: "aws_rds_read_latency_maximum"`)
+		assert.Contains(t, send(metric, statisticValue{"SampleCount", 1}), `fqName: "aws_rds_read_latency_sample_count"`)
+
+		p99 := send(metric, statisticValue{"p99.9", 1})
+		if suffix {
+			assert.Contains(t, p99, `fqName: "aws_rds_read_latency_p99_9"`)
+			assert.Contains(t, p99, "variableLabels: []")
+		} else {
+			assert.Contains(t, p99, `fqName: "aws_rds_read_latency_percentile"`)
+			assert.Contains(t, p99, "variableLabels: [quantile]")
+		}
+	}
+}
+
+func TestRatioMetric(t *testing.T) {
+	metric := Metric{
+		cwName:         "CPUUtilization",
+		prometheusName: "node_cpu_average",
+		prometheusHelp: "The percentage of CPU utilization. Units: Percent",
+		ratio:          true,
+	}
+	dp := &cloudwatch.Datapoint{
+		Average: aws.Float64(42),
+		Unit:    aws.String(cloudwatch.StandardUnitPercent),
+	}
+
+	r := ratioMetric(metric)
+	assert.Equal(t, "node_cpu_ratio", r.prometheusName)
+	assert.False(t, r.ratio)
+	assert.Equal(t, []statisticValue{{"Average", 0.42}}, datapointValues(r, dp))
+	assert.Equal(t, []statisticValue{{"Average", 42}}, datapointValues(metric, dp))
+}
+
+func TestInvalidMetricError(t *testing.T) {
+	assert.True(t, invalidMetricError(awserr.New("InvalidParameterCombination", "test", nil)))
+	assert.True(t, invalidMetricError(&apiError{api: "GetMetricStatistics", err: awserr.New("InvalidParameterCombination", "test", nil)}))
+	assert.True(t, invalidMetricError(fmt.Errorf("anomaly band: %w", &apiError{api: "GetMetricData", err: awserr.New("InvalidParameterValue", "test", nil)})))
+	assert.False(t, invalidMetricError(awserr.New("Throttling", "test", nil)))
+	assert.False(t, invalidMetricError(errors.New("test")))
+}
+
+func TestDimensions(t *testing.T) {
+	s := &Scraper{
+		instance:        &config.Instance{Instance: "db1"},
+		sessionInstance: &sessions.Instance{Instance: "db1", ClusterIdentifier: "cluster1"},
+	}
+
+	assert.Equal(t, []*cloudwatch.Dimension{
+		{Name: aws.String("DBInstanceIdentifier"), Value: aws.String("db1")},
+	}, s.dimensions(Metric{cwName: "CPUUtilization"}))
+	assert.Equal(t, []*cloudwatch.Dimension{
+		{Name: aws.String("DBClusterIdentifier"), Value: aws.String("cluster1")},
+	}, s.dimensions(AuroraMySQLMetrics[0]))
+}
+
+// slowCloudWatch is a CloudWatch API stub that blocks requests until their contexts are done.
+type slowCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+}
+
+func (slowCloudWatch) GetMetricStatisticsWithContext(ctx aws.Context, _ *cloudwatch.GetMetricStatisticsInput, _ ...request.Option) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowCloudWatch) GetMetricDataPagesWithContext(ctx aws.Context, _ *cloudwatch.GetMetricDataInput, _ func(*cloudwatch.GetMetricDataOutput, bool) bool, _ ...request.Option) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	defer func(v bool) { UseGetMetricData = v }(UseGetMetricData)
+
+	for _, getMetricData := range []bool{false, true} {
+		UseGetMetricData = getMetricData
+		collector := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		ch := make(chan prometheus.Metric, 1000)
+		s := &Scraper{
+			instance:        &config.Instance{Region: "us-east-1", Instance: "db1"},
+			collector:       collector,
+			ch:              ch,
+			ctx:             ctx,
+			cancel:          cancel,
+			sessionInstance: &sessions.Instance{Region: "us-east-1", Instance: "db1"},
+			svc:             slowCloudWatch{},
+			metrics:         collector.metricsFor("mysql"),
+			period:          Period,
+			values:          make(map[string]float64),
+		}
+
+		start := time.Now()
+		s.Scrape()
+		assert.Less(t, int64(time.Since(start)), int64(time.Second), "GetMetricData: %t", getMetricData)
+		assert.Equal(t, "error", s.state(start).Status)
+		assert.ErrorIs(t, s.lastErr, context.DeadlineExceeded)
+	}
+}
+
+// emptyCloudWatch is a CloudWatch API stub that returns no datapoints.
+type emptyCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+}
+
+func (emptyCloudWatch) GetMetricStatisticsWithContext(aws.Context, *cloudwatch.GetMetricStatisticsInput, ...request.Option) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	return new(cloudwatch.GetMetricStatisticsOutput), nil
+}
+
+func TestScrapeColdErrors(t *testing.T) {
+	defer func(v bool, threshold int) { UseGetMetricData, ColdThreshold = v, threshold }(UseGetMetricData, ColdThreshold)
+	UseGetMetricData = false
+	ColdThreshold = 3
+
+	collector := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	scrape := func(svc cloudwatchiface.CloudWatchAPI) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		s := &Scraper{
+			instance:        &config.Instance{Region: "us-east-1", Instance: "db1"},
+			collector:       collector,
+			ch:              make(chan prometheus.Metric, 1000),
+			ctx:             ctx,
+			cancel:          cancel,
+			sessionInstance: &sessions.Instance{Region: "us-east-1", Instance: "db1"},
+			svc:             svc,
+			metrics:         collector.metricsFor("mysql"),
+			period:          Period,
+			values:          make(map[string]float64),
+		}
+		s.Scrape()
+	}
+
+	// successful scrapes without datapoints make instance colder
+	scrape(emptyCloudWatch{})
+	scrape(emptyCloudWatch{})
+	assert.Equal(t, 2, collector.cold.streak("us-east-1/db1"))
+
+	// failed scrapes are not empty
+	scrape(slowCloudWatch{})
+	assert.Equal(t, 0, collector.cold.streak("us-east-1/db1"))
+}
+
+// fakeCloudWatch returns a CloudWatch-compatible server that answers every GetMetricStatistics request
+// with a single datapoint and records requested metric names.
+func fakeCloudWatch(t *testing.T, requested chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "GetMetricStatistics", r.Form.Get("Action"))
+		requested <- r.Form.Get("MetricName")
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<GetMetricStatisticsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <GetMetricStatisticsResult>
+    <Label>%s</Label>
+    <Datapoints>
+      <member>
+        <Timestamp>%s</Timestamp>
+        <Average>42</Average>
+        <Unit>Percent</Unit>
+      </member>
+    </Datapoints>
+  </GetMetricStatisticsResult>
+  <ResponseMetadata><RequestId>test</RequestId></ResponseMetadata>
+</GetMetricStatisticsResponse>`, r.Form.Get("MetricName"), time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	}))
+}
+
+func TestCloudWatchEndpoint(t *testing.T) {
+	defer func(v bool) { UseGetMetricData = v }(UseGetMetricData)
+	UseGetMetricData = false
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	// behavior without override is unchanged
+	svc, err := newCloudWatch(sess, &config.Instance{Region: "us-east-1", Instance: "db1"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://monitoring.us-east-1.amazonaws.com", svc.Endpoint)
+	assert.Equal(t, "us-east-1", svc.SigningRegion)
+	svc, err = newCloudWatch(sess, &config.Instance{Region: "us-east-1", Instance: "db1", UseFIPS: true})
+	require.NoError(t, err)
+	assert.Equal(t, "https://monitoring-fips.us-east-1.amazonaws.com", svc.Endpoint)
+
+	requested := make(chan string, 10)
+	server := fakeCloudWatch(t, requested)
+	defer server.Close()
+
+	instance := &config.Instance{Region: "us-east-1", Instance: "db1", CloudWatchEndpoint: server.URL, CloudWatchRegion: "eu-west-1"}
+	svc, err = newCloudWatch(sess, instance)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, svc.Endpoint)
+	assert.Equal(t, "eu-west-1", svc.SigningRegion)
+
+	collector := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scraper{
+		instance:        instance,
+		collector:       collector,
+		ctx:             ctx,
+		cancel:          cancel,
+		sessionInstance: &sessions.Instance{Region: "us-east-1", Instance: "db1"},
+		svc:             svc,
+		constLabels:     prometheus.Labels{"region": "us-east-1", "instance": "db1"},
+		metrics: []Metric{{
+			cwName:         "CPUUtilization",
+			prometheusName: "aws_rds_cpu_utilization_average",
+			prometheusHelp: "The percentage of CPU utilization.",
+		}},
+		period: Period,
+		rng:    10 * time.Minute,
+		values: make(map[string]float64),
+	}
+
+	expected := `# HELP aws_rds_cpu_utilization_average The percentage of CPU utilization.
+# TYPE aws_rds_cpu_utilization_average gauge
+aws_rds_cpu_utilization_average{instance="db1",region="us-east-1"} 42
+`
+	assert.NoError(t, testutil.CollectAndCompare(scrapeCollector{s}, strings.NewReader(expected), "aws_rds_cpu_utilization_average"))
+	assert.Equal(t, "CPUUtilization", <-requested)
+	assert.Equal(t, 0, s.errors)
+}
+
+// scrapeCollector runs a single scrape on collection.
+type scrapeCollector struct{ s *Scraper }
+
+func (c scrapeCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.ch = ch
+	c.s.Scrape()
+}
+
+func TestScrapeSummary(t *testing.T) {
+	defer func(v bool) { UseGetMetricData = v }(UseGetMetricData)
+	UseGetMetricData = false
+
+	requested := make(chan string, 10)
+	server := fakeCloudWatch(t, requested)
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	require.NoError(t, err)
+	instance := &config.Instance{Region: "us-east-1", Instance: "db1"}
+	svc, err := newCloudWatch(sess, instance)
+	require.NoError(t, err)
+
+	collector := New(new(config.Config), nil, promlog.New(&promlog.Config{}))
+	collector.countRequests(svc, instance.Region)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scraper{
+		instance:        instance,
+		collector:       collector,
+		ctx:             ctx,
+		cancel:          cancel,
+		sessionInstance: &sessions.Instance{Region: "us-east-1", Instance: "db1"},
+		svc:             svc,
+		constLabels:     prometheus.Labels{"region": "us-east-1", "instance": "db1"},
+		metrics: []Metric{{
+			cwName:         "CPUUtilization",
+			prometheusName: "aws_rds_cpu_utilization_average",
+			prometheusHelp: "The percentage of CPU utilization.",
+		}, {
+			cwName:         "FreeableMemory",
+			prometheusName: "aws_rds_freeable_memory_average",
+			prometheusHelp: "The amount of available random access memory.",
+		}},
+		period: 5 * time.Minute,
+		rng:    10 * time.Minute,
+		values: make(map[string]float64),
+	}
+
+	expected := `# HELP rds_exporter_effective_period_seconds Period of CloudWatch datapoints requested for the instance, adjusted to its resolution.
+# TYPE rds_exporter_effective_period_seconds gauge
+rds_exporter_effective_period_seconds{instance="db1",region="us-east-1"} 300
+# HELP rds_exporter_instance_metrics_collected Number of basic metrics that returned a datapoint for the instance in the last scrape.
+# TYPE rds_exporter_instance_metrics_collected gauge
+rds_exporter_instance_metrics_collected{instance="db1",region="us-east-1"} 2
+# HELP rds_exporter_instance_metrics_configured Number of basic metrics configured for the instance.
+# TYPE rds_exporter_instance_metrics_configured gauge
+rds_exporter_instance_metrics_configured{instance="db1",region="us-east-1"} 2
+`
+	names := []string{
+		"rds_exporter_effective_period_seconds",
+		"rds_exporter_instance_metrics_collected",
+		"rds_exporter_instance_metrics_configured",
+	}
+	assert.NoError(t, testutil.CollectAndCompare(scrapeCollector{s}, strings.NewReader(expected), names...))
+	assert.ElementsMatch(t, []string{"CPUUtilization", "FreeableMemory"}, []string{<-requested, <-requested})
+
+	// queried window is exposed as is
+	ch := make(chan prometheus.Metric, 100)
+	s.ch = ch
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.Scrape()
+	close(ch)
+	window := make(map[string]float64)
+	for m := range ch {
+		for _, name := range []string{"rds_exporter_query_window_start_timestamp_seconds", "rds_exporter_query_window_end_timestamp_seconds"} {
+			if strings.Contains(m.Desc().String(), `fqName: "`+name+`"`) {
+				window[name] = testutil.ToFloat64(metricCollector{m})
+			}
+		}
+	}
+	assert.InDelta(t, float64(s.start.UnixNano())/1e9, window["rds_exporter_query_window_start_timestamp_seconds"], 1e-3)
+	assert.InDelta(t, float64(s.end.UnixNano())/1e9, window["rds_exporter_query_window_end_timestamp_seconds"], 1e-3)
+	assert.Equal(t, 10*time.Minute, s.end.Sub(s.start))
+
+	// both scrapes are counted
+	assert.Equal(t, 4.0, testutil.ToFloat64(collector.mCloudWatchRequests.WithLabelValues("us-east-1", "GetMetricStatistics")))
+}
+
+// metricCollector collects a single metric.
+type metricCollector struct{ m prometheus.Metric }
+
+func (c metricCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.m.Desc() }
+
+func (c metricCollector) Collect(ch chan<- prometheus.Metric) { ch <- c.m }
@@ -0,0 +1,106 @@
+package basic
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// StaleMaxAge is a maximum age of the last good datapoint that is sent with stale="true" label
+// when CloudWatch request for it fails; 0 disables sending stale datapoints.
+var StaleMaxAge time.Duration
+
+// lastDatapoint is the latest datapoint of a single metric of a single instance from a successful request.
+type lastDatapoint struct {
+	dp *cloudwatch.Datapoint
+	at time.Time // when it was received
+}
+
+// lastDatapoints caches the latest datapoints of successful requests.
+type lastDatapoints struct {
+	m  sync.Mutex
+	dp map[string]lastDatapoint // region/instance/metricKey -> last datapoint
+}
+
+// store records the latest datapoint received at the given time.
+func (c *lastDatapoints) store(key string, dp *cloudwatch.Datapoint, at time.Time) {
+	if StaleMaxAge <= 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.dp == nil {
+		c.dp = make(map[string]lastDatapoint)
+	}
+	c.dp[key] = lastDatapoint{dp: dp, at: at}
+}
+
+// load returns the latest datapoint if it is not older than StaleMaxAge at the given time.
+func (c *lastDatapoints) load(key string, now time.Time) *cloudwatch.Datapoint {
+	if StaleMaxAge <= 0 {
+		return nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	last, ok := c.dp[key]
+	if !ok || now.Sub(last.at) > StaleMaxAge {
+		return nil
+	}
+	return last.dp
+}
+
+// evict removes datapoints older than StaleMaxAge at the given time.
+func (c *lastDatapoints) evict(now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for key, last := range c.dp {
+		if now.Sub(last.at) > StaleMaxAge {
+			delete(c.dp, key)
+		}
+	}
+}
+
+// sendStale sends the last good datapoint of the metric with stale="true" label, if there is a fresh enough one.
+func (s *Scraper) sendStale(metric Metric) {
+	dp := s.collector.lastDatapoints.load(s.datapointKey(metric), time.Now())
+	if dp == nil {
+		return
+	}
+
+	if metric.ratio && aws.StringValue(dp.Unit) == cloudwatch.StandardUnitPercent {
+		metric = ratioMetric(metric)
+	}
+	metric.stale = true
+	for _, sv := range datapointValues(metric, dp) {
+		s.sendStatistic(metric, sv, aws.TimeValue(dp.Timestamp))
+	}
+}
+
+// datapointKey returns lastDatapoints key for the metric of the instance.
+func (s *Scraper) datapointKey(metric Metric) string {
+	return s.instance.Region + "/" + s.instance.Instance + "/" + metricKey(metric)
+}
+
+// metricKey returns CloudWatch metric name with sorted extra dimensions, for example,
+// "CPUUtilization" or "DiskQueueDepth{VolumeId=vol-1}"; it distinguishes metrics with the same name.
+func metricKey(metric Metric) string {
+	if len(metric.dimensions) == 0 {
+		return metric.cwName
+	}
+
+	dimensions := make([]string, 0, len(metric.dimensions))
+	for n, v := range metric.dimensions {
+		dimensions = append(dimensions, n+"="+v)
+	}
+	sort.Strings(dimensions)
+	return metric.cwName + "{" + strings.Join(dimensions, ",") + "}"
+}
@@ -0,0 +1,82 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/percona/rds_exporter/config"
+)
+
+func TestLastDatapoints(t *testing.T) {
+	defer func(age time.Duration) { StaleMaxAge = age }(StaleMaxAge)
+
+	var c lastDatapoints
+	now := time.Now()
+	dp := &cloudwatch.Datapoint{Average: aws.Float64(42)}
+
+	StaleMaxAge = 0
+	c.store("key", dp, now)
+	assert.Nil(t, c.load("key", now))
+
+	StaleMaxAge = time.Minute
+	c.store("key", dp, now)
+	assert.Equal(t, dp, c.load("key", now.Add(time.Minute)))
+	assert.Nil(t, c.load("key", now.Add(2*time.Minute)))
+	assert.Nil(t, c.load("other", now))
+
+	c.evict(now.Add(30 * time.Second))
+	assert.Len(t, c.dp, 1)
+	c.evict(now.Add(2 * time.Minute))
+	assert.Empty(t, c.dp)
+}
+
+func TestSendStale(t *testing.T) {
+	defer func(age time.Duration) { StaleMaxAge = age }(StaleMaxAge)
+	StaleMaxAge = time.Minute
+
+	s := &Scraper{
+		instance:    &config.Instance{Region: "us-east-1", Instance: "db1"},
+		collector:   new(Collector),
+		constLabels: prometheus.Labels{"region": "us-east-1", "instance": "db1"},
+	}
+	metric := Metric{cwName: "CPUUtilization", prometheusName: "aws_rds_cpu_utilization_average", prometheusHelp: "CPUUtilization"}
+	collector := staleCollector{s, metric}
+
+	// nothing is sent without previous datapoint
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+
+	s.collector.lastDatapoints.store(s.datapointKey(metric), &cloudwatch.Datapoint{Average: aws.Float64(42)}, time.Now())
+	expected := `# HELP aws_rds_cpu_utilization_average CPUUtilization
+# TYPE aws_rds_cpu_utilization_average gauge
+aws_rds_cpu_utilization_average{instance="db1",region="us-east-1",stale="true"} 42
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func TestMetricKey(t *testing.T) {
+	assert.Equal(t, "CPUUtilization", metricKey(Metric{cwName: "CPUUtilization"}))
+
+	a := Metric{cwName: "DiskQueueDepth", dimensions: map[string]string{"VolumeId": "vol-1", "Role": "WRITER"}}
+	b := Metric{cwName: "DiskQueueDepth", dimensions: map[string]string{"VolumeId": "vol-2", "Role": "WRITER"}}
+	assert.Equal(t, "DiskQueueDepth{Role=WRITER,VolumeId=vol-1}", metricKey(a))
+	assert.NotEqual(t, metricKey(a), metricKey(b))
+}
+
+type staleCollector struct {
+	s      *Scraper
+	metric Metric
+}
+
+func (c staleCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c staleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.s.ch = ch
+	c.s.sendStale(c.metric)
+}
@@ -0,0 +1,89 @@
+package basic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// InstanceState is a diagnostic state of basic metrics scraping of a single instance.
+type InstanceState struct {
+	Region     string             `json:"region"`
+	Instance   string             `json:"instance"`
+	Disabled   bool               `json:"disabled"`
+	Period     string             `json:"period"`
+	Delay      string             `json:"delay"`
+	Range      string             `json:"range"`
+	Metrics    int                `json:"metrics"`               // number of configured metrics for instance's engine
+	Metadata   *sessions.Instance `json:"metadata,omitempty"`    // nil if there is no session for instance
+	LastScrape *ScrapeState       `json:"last_scrape,omitempty"` // nil if instance was not scraped yet
+	ColdStreak int                `json:"cold_streak"`           // consecutive scrapes without datapoints
+	Cold       bool               `json:"cold"`
+}
+
+// ScrapeState is a result of the last scrape of a single instance.
+type ScrapeState struct {
+	Time      time.Time `json:"time"`
+	Duration  string    `json:"duration"`
+	Status    string    `json:"status"`    // "ok", "error", "cold", or "no_scraper"
+	Collected int       `json:"collected"` // number of metrics that returned datapoints
+	Errors    int       `json:"errors"`    // number of failed metric requests
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// scrapeStates tracks the last scrapes of instances.
+type scrapeStates struct {
+	m      sync.Mutex
+	states map[string]ScrapeState // region/instance -> last scrape
+}
+
+// store records the last scrape of the instance.
+func (c *scrapeStates) store(key string, state ScrapeState) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.states == nil {
+		c.states = make(map[string]ScrapeState)
+	}
+	c.states[key] = state
+}
+
+// load returns the last scrape of the instance, or nil.
+func (c *scrapeStates) load(key string) *ScrapeState {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	state, ok := c.states[key]
+	if !ok {
+		return nil
+	}
+	return &state
+}
+
+// State returns diagnostic state of all configured instances in configuration order.
+func (e *Collector) State() []InstanceState {
+	res := make([]InstanceState, 0, len(e.config.Instances))
+	for _, instance := range e.config.Instances {
+		key := instance.Region + "/" + instance.Instance
+		streak := e.cold.streak(key)
+		period, delay, rng := scrapeWindow(&instance)
+		state := InstanceState{
+			Region:     instance.Region,
+			Instance:   instance.Instance,
+			Disabled:   instance.DisableBasicMetrics,
+			Period:     period.String(),
+			Delay:      delay.String(),
+			Range:      rng.String(),
+			LastScrape: e.scrapes.load(key),
+			ColdStreak: streak,
+			Cold:       ColdThreshold > 0 && streak >= ColdThreshold,
+		}
+		if _, metadata := e.sessions.GetSession(instance.Region, instance.Instance); metadata != nil {
+			state.Metadata = metadata
+			state.Metrics = len(e.metricsFor(metadata.Engine))
+		}
+		res = append(res, state)
+	}
+	return res
+}
@@ -0,0 +1,32 @@
+package basic
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeStates(t *testing.T) {
+	var c scrapeStates
+	const key = "us-east-1/test"
+	assert.Nil(t, c.load(key))
+
+	start := time.Now()
+	s := &Scraper{values: map[string]float64{"CPUUtilization": 1}}
+	c.store(key, s.state(start))
+	state := c.load(key)
+	assert.Equal(t, start, state.Time)
+	assert.Equal(t, "ok", state.Status)
+	assert.Equal(t, 1, state.Collected)
+	assert.Empty(t, state.LastError)
+
+	s.errors = 2
+	s.lastErr = errors.New("FreeStorageSpace: throttled")
+	c.store(key, s.state(start))
+	state = c.load(key)
+	assert.Equal(t, "error", state.Status)
+	assert.Equal(t, 2, state.Errors)
+	assert.Equal(t, "FreeStorageSpace: throttled", state.LastError)
+}
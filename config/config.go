@@ -1,8 +1,18 @@
 package config
 
 import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"gopkg.in/yaml.v2"
 )
 
@@ -25,11 +35,37 @@ type Instance struct {
 	AWSRoleArn             string            `yaml:"aws_role_arn"`   // may be empty
 	DisableBasicMetrics    bool              `yaml:"disable_basic_metrics"`
 	DisableEnhancedMetrics bool              `yaml:"disable_enhanced_metrics"`
-	Labels                 map[string]string `yaml:"labels"` // may be empty
+	UseFIPS                bool              `yaml:"use_fips"`            // use FIPS CloudWatch endpoint
+	CloudWatchEndpoint     string            `yaml:"cloudwatch_endpoint"` // may be empty for default AWS endpoint
+	CloudWatchRegion       string            `yaml:"cloudwatch_region"`   // signing region for cloudwatch_endpoint; may be empty for region
+	Labels                 map[string]string `yaml:"labels"`              // may be empty; values may contain "{{.Field}}" templates
+
+	// Resolution of published CloudWatch metrics, for example, 5m for basic monitoring; may be empty for 1m.
+	// Requested period is increased to a multiple of it.
+	Resolution time.Duration `yaml:"resolution"`
+
+	// CloudWatch request window: period of datapoints, delay of window end from now, and window length;
+	// may be empty for exporter defaults (1m, 10m, and 10m). Delay may be set to 0 for engines that publish metrics promptly.
+	Period time.Duration  `yaml:"period"`
+	Delay  *time.Duration `yaml:"delay"`
+	Range  time.Duration  `yaml:"range"`
+
+	// Secondary instances of Aurora global database in other regions; may be empty.
+	// They are scraped with the same settings and labeled with role=secondary, this instance is labeled with role=primary.
+	GlobalSecondaries []GlobalSecondary `yaml:"global_secondaries"`
 
 	// TODO Type InstanceType `yaml:"type"` // may be empty for old pmm-managed
 }
 
+// GlobalSecondary represents a secondary instance of Aurora global database.
+// Unlike other settings, use_fips is not inherited from the primary instance
+// because FIPS endpoints are not available in all regions.
+type GlobalSecondary struct {
+	Region   string `yaml:"region"`
+	Instance string `yaml:"instance"`
+	UseFIPS  bool   `yaml:"use_fips"`
+}
+
 func (i Instance) String() string {
 	res := i.Region + "/" + i.Instance
 	if i.AWSAccessKey != "" {
@@ -39,9 +75,414 @@ func (i Instance) String() string {
 	return res
 }
 
+// Metric represents settings of a single basic metric from configuration file.
+type Metric struct {
+	Name               string            `yaml:"name"`                // CloudWatch metric name
+	Statistics         []string          `yaml:"statistics"`          // may be empty for Average only
+	ExtendedStatistics []string          `yaml:"extended_statistics"` // may be empty
+	MinValue           *float64          `yaml:"min_value"`           // values below are not exposed; may be empty
+	MaxValue           *float64          `yaml:"max_value"`           // values above are not exposed; may be empty
+	Dimensions         map[string]string `yaml:"dimensions"`          // in addition to DBInstanceIdentifier; may be empty
+	AnomalyBand        bool              `yaml:"anomaly_band"`        // expose CloudWatch anomaly detection band if detector exists
+	Ratio              bool              `yaml:"ratio"`               // expose Percent values as 0-1 ratios
+	Stddev             bool              `yaml:"stddev"`              // also expose standard deviation over the range
+	ScaleFactor        *float64          `yaml:"scale_factor"`        // values are multiplied by it; may be empty for 1
+	TargetUnit         string            `yaml:"target_unit"`         // unit of scaled values added to metric name; may be empty
+}
+
+// Naming schemes of metrics for percentiles (extended statistics).
+// Standard statistics other than Average always use name suffixes like aws_rds_read_latency_maximum.
+const (
+	StatisticNamingLabel  = "label"  // percentile is a quantile label value: aws_rds_read_latency_percentile{quantile="0.99"}
+	StatisticNamingSuffix = "suffix" // percentile is a name suffix: aws_rds_read_latency_p99
+)
+
 // Config contains configuration file information.
 type Config struct {
-	Instances []Instance `yaml:"instances"`
+	Instances         []Instance        `yaml:"instances"`
+	Metrics           []Metric          `yaml:"metrics"`             // may be empty
+	StatisticNaming   string            `yaml:"statistic_naming"`    // may be empty for StatisticNamingLabel
+	HealthScore       *HealthScore      `yaml:"health_score"`        // may be empty to disable health score
+	MinEngineVersions map[string]string `yaml:"min_engine_versions"` // engine -> minimal version; may be empty
+	EnhancedMetrics   []EnhancedMetric  `yaml:"enhanced_metrics"`    // may be empty
+}
+
+// EnhancedProcessListPrefix is a name prefix of per-process enhanced metrics that can be filtered by value.
+const EnhancedProcessListPrefix = "rdsosmetrics_processList_"
+
+// EnhancedMetric represents enhanced metric settings.
+type EnhancedMetric struct {
+	Name     string   `yaml:"name"`      // for example, "rdsosmetrics_processList_cpuUsedPc"
+	MinValue *float64 `yaml:"min_value"` // values below are not exposed; may be empty
+	MaxValue *float64 `yaml:"max_value"` // values above are not exposed; may be empty
+}
+
+// HealthScoreComponents are utilization percentages that can be used for health score.
+// Memory and connections are not included because their limits are not known to the exporter.
+var HealthScoreComponents = []string{"cpu", "storage", "iops"}
+
+// HealthScore represents settings of composite instance health score.
+type HealthScore struct {
+	Weights map[string]float64 `yaml:"weights"` // component -> weight; may be empty for equal weights
+}
+
+// Weight returns weight of the given health score component.
+func (h *HealthScore) Weight(component string) float64 {
+	if len(h.Weights) == 0 {
+		return 1
+	}
+	return h.Weights[component]
+}
+
+// ParseEngineVersion returns numeric components of RDS engine version, ignoring non-numeric suffixes.
+// For example, "13.7" is [13 7], "8.0.mysql_aurora.3.02.0" is [3 2 0], "15.00.4198.2.v1" is [15 0 4198 2],
+// and "19.0.0.0.ru-2022-01.rur-2022-01.r1" is [19 0 0 0].
+func ParseEngineVersion(version string) ([]int, error) {
+	// Aurora MySQL versions contain compatible MySQL version before Aurora one
+	if i := strings.Index(version, "mysql_aurora."); i >= 0 {
+		version = version[i+len("mysql_aurora."):]
+	}
+
+	var res []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		res = append(res, n)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("invalid engine version %q", version)
+	}
+	return res, nil
+}
+
+// CompareEngineVersions returns -1, 0, or 1 if version a is lower than, equal to, or greater than b.
+// Missing components are treated as zeros.
+func CompareEngineVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// ShardOf returns a shard number in [0, totalShards) for the given instance.
+// It depends only on instance's region and identifier, so all exporter replicas agree on it.
+func ShardOf(instance Instance, totalShards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(instance.Region + "/" + instance.Instance))
+	return int(h.Sum32() % uint32(totalShards))
+}
+
+// FilterShard removes instances that do not belong to the given shard.
+func (c *Config) FilterShard(shard, totalShards int) error {
+	if totalShards < 1 {
+		return fmt.Errorf("total shards should be positive, got %d", totalShards)
+	}
+	if shard < 0 || shard >= totalShards {
+		return fmt.Errorf("shard should be in [0, %d), got %d", totalShards, shard)
+	}
+
+	instances := make([]Instance, 0, len(c.Instances)/totalShards+1)
+	for _, instance := range c.Instances {
+		if ShardOf(instance, totalShards) == shard {
+			instances = append(instances, instance)
+		}
+	}
+	c.Instances = instances
+	return nil
+}
+
+// expandGlobalSecondaries adds global databases secondary instances to the instances list.
+func (c *Config) expandGlobalSecondaries() {
+	instances := make([]Instance, 0, len(c.Instances))
+	for _, i := range c.Instances {
+		if len(i.GlobalSecondaries) == 0 {
+			instances = append(instances, i)
+			continue
+		}
+
+		secondaries := i.GlobalSecondaries
+		i.GlobalSecondaries = nil
+		instances = append(instances, i.withRole("primary"))
+		for _, s := range secondaries {
+			secondary := i
+			secondary.Region = s.Region
+			secondary.Instance = s.Instance
+			secondary.UseFIPS = s.UseFIPS
+			instances = append(instances, secondary.withRole("secondary"))
+		}
+	}
+	c.Instances = instances
+}
+
+// withRole returns a copy of instance with role label set unless it is already present.
+func (i Instance) withRole(role string) Instance {
+	labels := make(map[string]string, len(i.Labels)+1)
+	for k, v := range i.Labels {
+		labels[k] = v
+	}
+	if _, ok := labels["role"]; !ok {
+		labels["role"] = role
+	}
+	i.Labels = labels
+	return i
+}
+
+// validateWindow checks instance's CloudWatch request window.
+func (i Instance) validateWindow() error {
+	// RDS publishes CloudWatch metrics with 1 minute resolution at best, and periods are multiples of 1m anyway
+	if i.Resolution < 0 || i.Resolution%time.Minute != 0 {
+		return fmt.Errorf("invalid resolution %s: should be a multiple of 1m", i.Resolution)
+	}
+	if i.Period < 0 || i.Period%time.Minute != 0 {
+		return fmt.Errorf("invalid period %s: should be a multiple of 1m", i.Period)
+	}
+	if i.Delay != nil && *i.Delay < 0 {
+		return fmt.Errorf("invalid delay %s: should not be negative", *i.Delay)
+	}
+	if i.Range < 0 {
+		return fmt.Errorf("invalid range %s: should not be negative", i.Range)
+	}
+	if i.Range == 0 {
+		return nil
+	}
+
+	// default period is 1m; it is increased to a multiple of resolution
+	period := time.Minute
+	if i.Period > period {
+		period = i.Period
+	}
+	if i.Resolution > period {
+		period = i.Resolution
+	}
+	if i.Range < period {
+		return fmt.Errorf("invalid range %s: should not be less than period %s", i.Range, period)
+	}
+	return nil
+}
+
+// Statistics are CloudWatch statistics that can be used in metric's statistics.
+var Statistics = []string{"Average", "Minimum", "Maximum", "Sum", "SampleCount"}
+
+// targetUnitRE matches units that can be used in metric names, like "bytes" or "seconds".
+var targetUnitRE = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// LabelTemplateFields are instance metadata fields that can be referenced in label values, for example, "{{.ClusterIdentifier}}".
+var LabelTemplateFields = []string{"Region", "Instance", "Engine", "EngineVersion", "InstanceClass", "StorageType", "ClusterIdentifier", "ResourceID"}
+
+// labelTemplateRE matches a single "{{.Field}}" reference.
+var labelTemplateRE = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// ExpandLabelTemplate returns label value with "{{.Field}}" references replaced with given fields values.
+// Unknown fields are replaced with empty strings; use checkLabelTemplate to reject them beforehand.
+func ExpandLabelTemplate(value string, fields map[string]string) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	return labelTemplateRE.ReplaceAllStringFunc(value, func(ref string) string {
+		return fields[labelTemplateRE.FindStringSubmatch(ref)[1]]
+	})
+}
+
+// checkLabelTemplate returns an error if label value contains invalid templates or references unknown fields.
+func checkLabelTemplate(value string) error {
+	for _, m := range labelTemplateRE.FindAllStringSubmatch(value, -1) {
+		var found bool
+		for _, known := range LabelTemplateFields {
+			found = found || known == m[1]
+		}
+		if !found {
+			return fmt.Errorf("unknown field %q in template %q, should be one of %v", m[1], value, LabelTemplateFields)
+		}
+	}
+	if rest := labelTemplateRE.ReplaceAllString(value, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return fmt.Errorf("invalid template %q: only {{.Field}} references are supported", value)
+	}
+	return nil
+}
+
+// extendedStatisticRE matches CloudWatch percentile statistics from p0 to p100 with up to two decimal places.
+var extendedStatisticRE = regexp.MustCompile(`^p(\d{1,2}(\.\d{1,2})?|100)$`)
+
+// validate checks configuration for errors.
+func (c *Config) validate() error {
+	for _, i := range c.Instances {
+		if i.UseFIPS {
+			if _, err := CloudWatchFIPSEndpoint(i.Region); err != nil {
+				return fmt.Errorf("instance %s: %w", i, err)
+			}
+		}
+		if i.CloudWatchEndpoint != "" {
+			if i.UseFIPS {
+				return fmt.Errorf("instance %s: use_fips and cloudwatch_endpoint can't be used together", i)
+			}
+			if err := validEndpoint(i.CloudWatchEndpoint); err != nil {
+				return fmt.Errorf("instance %s: %w", i, err)
+			}
+		}
+		if i.CloudWatchRegion != "" && i.CloudWatchEndpoint == "" {
+			return fmt.Errorf("instance %s: cloudwatch_region can be used only with cloudwatch_endpoint", i)
+		}
+		if err := i.validateWindow(); err != nil {
+			return fmt.Errorf("instance %s: %w", i, err)
+		}
+		for name, value := range i.Labels {
+			if err := checkLabelTemplate(value); err != nil {
+				return fmt.Errorf("instance %s: label %s: %w", i, name, err)
+			}
+		}
+	}
+
+	switch c.StatisticNaming {
+	case "", StatisticNamingLabel, StatisticNamingSuffix:
+		// nothing
+	default:
+		return fmt.Errorf("invalid statistic_naming %q: should be %q or %q", c.StatisticNaming, StatisticNamingLabel, StatisticNamingSuffix)
+	}
+
+	for engine, version := range c.MinEngineVersions {
+		if _, err := ParseEngineVersion(version); err != nil {
+			return fmt.Errorf("min_engine_versions: engine %q: %s", engine, err)
+		}
+	}
+
+	if c.HealthScore != nil {
+		for component, weight := range c.HealthScore.Weights {
+			var found bool
+			for _, known := range HealthScoreComponents {
+				found = found || known == component
+			}
+			if !found {
+				return fmt.Errorf("health_score: unknown component %q, should be one of %v", component, HealthScoreComponents)
+			}
+			if weight < 0 {
+				return fmt.Errorf("health_score: negative weight %v of component %q", weight, component)
+			}
+		}
+	}
+
+	for _, m := range c.EnhancedMetrics {
+		if !strings.HasPrefix(m.Name, EnhancedProcessListPrefix) {
+			return fmt.Errorf("enhanced metric %q: only %s* metrics can be filtered", m.Name, EnhancedProcessListPrefix)
+		}
+		if m.MinValue != nil && m.MaxValue != nil && *m.MinValue > *m.MaxValue {
+			return fmt.Errorf("enhanced metric %s: min_value %v is greater than max_value %v", m.Name, *m.MinValue, *m.MaxValue)
+		}
+	}
+
+	// dimensions are exposed as labels of all instances' metrics
+	reservedLabels := make(map[string]bool)
+	for _, l := range ReservedLabels {
+		reservedLabels[l] = true
+	}
+	for _, i := range c.Instances {
+		for l := range i.Labels {
+			reservedLabels[l] = true
+		}
+	}
+	for _, m := range c.Metrics {
+		if m.Name == "" {
+			return fmt.Errorf("metric name is empty")
+		}
+		if m.MinValue != nil && m.MaxValue != nil && *m.MinValue > *m.MaxValue {
+			return fmt.Errorf("metric %s: min_value %v is greater than max_value %v", m.Name, *m.MinValue, *m.MaxValue)
+		}
+		for _, s := range m.Statistics {
+			var found bool
+			for _, known := range Statistics {
+				found = found || known == s
+			}
+			if !found {
+				return fmt.Errorf("metric %s: unknown statistic %q, should be one of %v", m.Name, s, Statistics)
+			}
+		}
+		for _, s := range m.ExtendedStatistics {
+			if !extendedStatisticRE.MatchString(s) {
+				return fmt.Errorf("metric %s: invalid extended statistic %q", m.Name, s)
+			}
+		}
+		if m.ScaleFactor != nil && (*m.ScaleFactor == 0 || math.IsInf(*m.ScaleFactor, 0) || math.IsNaN(*m.ScaleFactor)) {
+			return fmt.Errorf("metric %s: scale_factor should be a finite non-zero number, got %v", m.Name, *m.ScaleFactor)
+		}
+		if m.TargetUnit != "" && !targetUnitRE.MatchString(m.TargetUnit) {
+			return fmt.Errorf("metric %s: invalid target_unit %q: should contain only lowercase letters, digits, and underscores", m.Name, m.TargetUnit)
+		}
+		for name, value := range m.Dimensions {
+			if name == "" || value == "" {
+				return fmt.Errorf("metric %s: dimension name and value should not be empty", m.Name)
+			}
+			if name == "DBInstanceIdentifier" {
+				return fmt.Errorf("metric %s: dimension DBInstanceIdentifier is always set", m.Name)
+			}
+			if label := SnakeCase(name); reservedLabels[label] {
+				return fmt.Errorf("metric %s: dimension %s label %q collides with exporter's or configured label", m.Name, name, label)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SnakeCase converts CloudWatch name (like "CPUUtilization") to Prometheus one (like "cpu_utilization").
+func SnakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			// plural "s" after acronym (like "IOPs") is not a separate word
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && string(runes[i+1:]) != "s"
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// ReservedLabels are names of labels set by the exporter for basic metrics in addition to configured ones.
+var ReservedLabels = []string{"region", "instance", "stale", "quantile"}
+
+// CloudWatchEndpointEnv is an environment variable with CloudWatch endpoint URL used for instances
+// without cloudwatch_endpoint and use_fips options, for example, for LocalStack.
+const CloudWatchEndpointEnv = "RDS_EXPORTER_CLOUDWATCH_ENDPOINT"
+
+// applyCloudWatchEndpointEnv sets CloudWatch endpoint from environment variable value for instances without explicit one.
+func (c *Config) applyCloudWatchEndpointEnv(endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	for i := range c.Instances {
+		if c.Instances[i].CloudWatchEndpoint == "" && !c.Instances[i].UseFIPS {
+			c.Instances[i].CloudWatchEndpoint = endpoint
+		}
+	}
+}
+
+// validEndpoint returns an error if CloudWatch endpoint is not an absolute HTTP(S) URL.
+func validEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid cloudwatch_endpoint %q: %w", endpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid cloudwatch_endpoint %q: should be an absolute http or https URL", endpoint)
+	}
+	return nil
 }
 
 // Load loads configuration from file.
@@ -55,6 +496,20 @@ func Load(filename string) (*Config, error) {
 	if err = yaml.Unmarshal(b, &config); err != nil {
 		return nil, err
 	}
+	config.expandGlobalSecondaries()
+	config.applyCloudWatchEndpointEnv(os.Getenv(CloudWatchEndpointEnv))
+	if err = config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// CloudWatchFIPSEndpoint returns CloudWatch FIPS endpoint URL for given region.
+func CloudWatchFIPSEndpoint(region string) (string, error) {
+	e, err := endpoints.DefaultResolver().EndpointFor("monitoring", "fips-"+region, endpoints.StrictMatchingOption)
+	if err != nil {
+		return "", fmt.Errorf("region %s does not support CloudWatch FIPS endpoint: %w", region, err)
+	}
+	return e.URL, nil
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudWatchFIPSEndpoint(t *testing.T) {
+	endpoint, err := CloudWatchFIPSEndpoint("us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://monitoring-fips.us-east-1.amazonaws.com", endpoint)
+
+	_, err = CloudWatchFIPSEndpoint("eu-west-1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "region eu-west-1 does not support CloudWatch FIPS endpoint")
+}
+
+func TestCloudWatchEndpoint(t *testing.T) {
+	c := &Config{Instances: []Instance{
+		{Region: "us-east-1", Instance: "db1"},
+		{Region: "us-east-1", Instance: "db2", UseFIPS: true},
+		{Region: "eu-west-1", Instance: "db3", CloudWatchEndpoint: "http://localhost:4567"},
+	}}
+	c.applyCloudWatchEndpointEnv("")
+	assert.Equal(t, "", c.Instances[0].CloudWatchEndpoint)
+
+	c.applyCloudWatchEndpointEnv("http://localhost:4566")
+	assert.Equal(t, "http://localhost:4566", c.Instances[0].CloudWatchEndpoint)
+	assert.Equal(t, "", c.Instances[1].CloudWatchEndpoint)
+	assert.Equal(t, "http://localhost:4567", c.Instances[2].CloudWatchEndpoint)
+	assert.NoError(t, c.validate())
+
+	assert.NoError(t, validEndpoint("https://monitoring.example.com/"))
+	assert.EqualError(t, validEndpoint("localhost:4566"), `invalid cloudwatch_endpoint "localhost:4566": should be an absolute http or https URL`)
+
+	c.Instances[2].CloudWatchRegion = "us-east-1"
+	assert.NoError(t, c.validate())
+	c.Instances[1].CloudWatchRegion = "us-east-1"
+	assert.EqualError(t, c.validate(), "instance us-east-1/db2: cloudwatch_region can be used only with cloudwatch_endpoint")
+
+	c.Instances[1].CloudWatchRegion = ""
+	c.Instances[1].CloudWatchEndpoint = "http://localhost:4566"
+	assert.EqualError(t, c.validate(), "instance us-east-1/db2: use_fips and cloudwatch_endpoint can't be used together")
+}
+
+func TestExpandGlobalSecondaries(t *testing.T) {
+	c := &Config{
+		Instances: []Instance{{
+			Region:       "us-east-1",
+			Instance:     "global-1",
+			AWSAccessKey: "key",
+			UseFIPS:      true,
+			Labels:       map[string]string{"env": "prod"},
+			GlobalSecondaries: []GlobalSecondary{{
+				Region:   "eu-west-1",
+				Instance: "global-1-eu",
+			}, {
+				Region:   "us-west-2",
+				Instance: "global-1-us",
+				UseFIPS:  true,
+			}},
+		}, {
+			Region:   "us-east-1",
+			Instance: "regular",
+		}},
+	}
+	c.expandGlobalSecondaries()
+
+	expected := []Instance{{
+		Region:       "us-east-1",
+		Instance:     "global-1",
+		AWSAccessKey: "key",
+		UseFIPS:      true,
+		Labels:       map[string]string{"env": "prod", "role": "primary"},
+	}, {
+		Region:       "eu-west-1",
+		Instance:     "global-1-eu",
+		AWSAccessKey: "key",
+		Labels:       map[string]string{"env": "prod", "role": "secondary"},
+	}, {
+		Region:       "us-west-2",
+		Instance:     "global-1-us",
+		AWSAccessKey: "key",
+		UseFIPS:      true,
+		Labels:       map[string]string{"env": "prod", "role": "secondary"},
+	}, {
+		Region:   "us-east-1",
+		Instance: "regular",
+	}}
+	assert.Equal(t, expected, c.Instances)
+}
+
+func TestFilterShard(t *testing.T) {
+	var instances []Instance
+	for i := 0; i < 100; i++ {
+		instances = append(instances, Instance{Region: "us-east-1", Instance: fmt.Sprintf("instance-%d", i)})
+	}
+
+	seen := make(map[string]int)
+	for shard := 0; shard < 3; shard++ {
+		c := &Config{Instances: instances}
+		require.NoError(t, c.FilterShard(shard, 3))
+		assert.NotEmpty(t, c.Instances)
+		for _, instance := range c.Instances {
+			seen[instance.Instance]++
+			assert.Equal(t, shard, ShardOf(instance, 3))
+		}
+	}
+	assert.Len(t, seen, len(instances))
+	for name, n := range seen {
+		assert.Equal(t, 1, n, name)
+	}
+
+	c := &Config{Instances: instances}
+	require.NoError(t, c.FilterShard(0, 1))
+	assert.Equal(t, instances, c.Instances)
+
+	assert.Error(t, c.FilterShard(0, 0))
+	assert.Error(t, c.FilterShard(3, 3))
+	assert.Error(t, c.FilterShard(-1, 3))
+}
+
+func TestParseEngineVersion(t *testing.T) {
+	for version, expected := range map[string][]int{
+		"13.7":                               {13, 7},
+		"8.0.28":                             {8, 0, 28},
+		"5.7.mysql_aurora.2.10.2":            {2, 10, 2},
+		"8.0.mysql_aurora.3.02.0":            {3, 2, 0},
+		"11.9":                               {11, 9},
+		"15.00.4198.2.v1":                    {15, 0, 4198, 2},
+		"19.0.0.0.ru-2022-01.rur-2022-01.r1": {19, 0, 0, 0},
+	} {
+		actual, err := ParseEngineVersion(version)
+		require.NoError(t, err, version)
+		assert.Equal(t, expected, actual, version)
+	}
+
+	_, err := ParseEngineVersion("v1")
+	assert.Error(t, err)
+}
+
+func TestCompareEngineVersions(t *testing.T) {
+	assert.Equal(t, -1, CompareEngineVersions([]int{13, 6}, []int{13, 7}))
+	assert.Equal(t, 0, CompareEngineVersions([]int{13, 7}, []int{13, 7, 0}))
+	assert.Equal(t, 1, CompareEngineVersions([]int{14}, []int{13, 7}))
+	assert.Equal(t, 1, CompareEngineVersions([]int{3, 2, 1}, []int{3, 2}))
+}
+
+func TestLabelTemplate(t *testing.T) {
+	fields := map[string]string{"ClusterIdentifier": "cluster1", "Engine": "aurora-mysql"}
+	assert.Equal(t, "static", ExpandLabelTemplate("static", fields))
+	assert.Equal(t, "cluster1", ExpandLabelTemplate("{{.ClusterIdentifier}}", fields))
+	assert.Equal(t, "cluster1/aurora-mysql", ExpandLabelTemplate("{{ .ClusterIdentifier }}/{{.Engine}}", fields))
+	assert.Equal(t, "", ExpandLabelTemplate("{{.ResourceID}}", fields))
+
+	assert.NoError(t, checkLabelTemplate("static"))
+	assert.NoError(t, checkLabelTemplate("{{.ClusterIdentifier}}-{{.Region}}"))
+	assert.EqualError(t, checkLabelTemplate("{{.Cluster}}"),
+		`unknown field "Cluster" in template "{{.Cluster}}", should be one of [Region Instance Engine EngineVersion InstanceClass StorageType ClusterIdentifier ResourceID]`)
+	assert.EqualError(t, checkLabelTemplate("{{.ClusterIdentifier | printf}}"),
+		`invalid template "{{.ClusterIdentifier | printf}}": only {{.Field}} references are supported`)
+}
+
+func TestValidateMetricConversion(t *testing.T) {
+	zero, scale := 0.0, 1024.0
+	for _, m := range []Metric{
+		{Name: "FreeableMemory", ScaleFactor: &scale},
+		{Name: "FreeableMemory", ScaleFactor: &scale, TargetUnit: "kibibytes"},
+	} {
+		assert.NoError(t, (&Config{Metrics: []Metric{m}}).validate())
+	}
+
+	err := (&Config{Metrics: []Metric{{Name: "FreeableMemory", ScaleFactor: &zero}}}).validate()
+	assert.EqualError(t, err, "metric FreeableMemory: scale_factor should be a finite non-zero number, got 0")
+	err = (&Config{Metrics: []Metric{{Name: "FreeableMemory", TargetUnit: "KiB"}}}).validate()
+	assert.EqualError(t, err, `metric FreeableMemory: invalid target_unit "KiB": should contain only lowercase letters, digits, and underscores`)
+}
+
+func TestValidateStatistics(t *testing.T) {
+	err := (&Config{Metrics: []Metric{{Name: "WriteIOPS", Statistics: []string{"Sum", "Maximum"}}}}).validate()
+	assert.NoError(t, err)
+
+	err = (&Config{Metrics: []Metric{{Name: "WriteIOPS", Statistics: []string{"Max"}}}}).validate()
+	assert.EqualError(t, err, `metric WriteIOPS: unknown statistic "Max", should be one of [Average Minimum Maximum Sum SampleCount]`)
+}
+
+func TestValidateWindow(t *testing.T) {
+	zero, negative := time.Duration(0), -time.Minute
+	for _, i := range []Instance{
+		{},
+		{Period: 5 * time.Minute, Delay: &zero, Range: 15 * time.Minute},
+		{Range: time.Minute},
+	} {
+		assert.NoError(t, i.validateWindow(), "%+v", i)
+	}
+
+	for _, tc := range []struct {
+		instance Instance
+		expected string
+	}{
+		{Instance{Resolution: 30 * time.Second}, "invalid resolution 30s: should be a multiple of 1m"},
+		{Instance{Resolution: -time.Minute}, "invalid resolution -1m0s: should be a multiple of 1m"},
+		{Instance{Period: 30 * time.Second}, "invalid period 30s: should be a multiple of 1m"},
+		{Instance{Delay: &negative}, "invalid delay -1m0s: should not be negative"},
+		{Instance{Period: 5 * time.Minute, Range: 2 * time.Minute}, "invalid range 2m0s: should not be less than period 5m0s"},
+		{Instance{Resolution: 5 * time.Minute, Range: 2 * time.Minute}, "invalid range 2m0s: should not be less than period 5m0s"},
+		{Instance{Range: 30 * time.Second}, "invalid range 30s: should not be less than period 1m0s"},
+	} {
+		assert.EqualError(t, tc.instance.validateWindow(), tc.expected)
+	}
+}
+
+func TestValidateEnhancedMetrics(t *testing.T) {
+	one, two := 1.0, 2.0
+	err := (&Config{EnhancedMetrics: []EnhancedMetric{{Name: "rdsosmetrics_processList_cpuUsedPc", MinValue: &one}}}).validate()
+	assert.NoError(t, err)
+
+	err = (&Config{EnhancedMetrics: []EnhancedMetric{{Name: "node_load1", MinValue: &one}}}).validate()
+	assert.EqualError(t, err, `enhanced metric "node_load1": only rdsosmetrics_processList_* metrics can be filtered`)
+	err = (&Config{EnhancedMetrics: []EnhancedMetric{{Name: "rdsosmetrics_processList_rss", MinValue: &two, MaxValue: &one}}}).validate()
+	assert.EqualError(t, err, "enhanced metric rdsosmetrics_processList_rss: min_value 2 is greater than max_value 1")
+}
+
+func TestSnakeCase(t *testing.T) {
+	for cw, expected := range map[string]string{
+		"CPUUtilization":         "cpu_utilization",
+		"ReplicationChannelLag":  "replication_channel_lag",
+		"VolumeReadIOPs":         "volume_read_iops",
+		"AuroraGlobalDBProgress": "aurora_global_db_progress",
+		"Channel":                "channel",
+		"CPUCreditBalance":       "cpu_credit_balance",
+		"DBClusterIdentifier":    "db_cluster_identifier",
+	} {
+		assert.Equal(t, expected, SnakeCase(cw), cw)
+	}
+}
+
+func TestValidateDimensions(t *testing.T) {
+	c := &Config{
+		Instances: []Instance{{Region: "us-east-1", Instance: "db1", Labels: map[string]string{"channel_owner": "dba"}}},
+		Metrics:   []Metric{{Name: "ReplicationChannelLag", Dimensions: map[string]string{"Channel": "channel1"}}},
+	}
+	assert.NoError(t, c.validate())
+
+	for name, expected := range map[string]string{
+		"Region":       `metric ReplicationChannelLag: dimension Region label "region" collides with exporter's or configured label`,
+		"Stale":        `metric ReplicationChannelLag: dimension Stale label "stale" collides with exporter's or configured label`,
+		"ChannelOwner": `metric ReplicationChannelLag: dimension ChannelOwner label "channel_owner" collides with exporter's or configured label`,
+	} {
+		c.Metrics[0].Dimensions = map[string]string{name: "value"}
+		assert.EqualError(t, c.validate(), expected, name)
+	}
+}
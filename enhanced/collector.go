@@ -6,17 +6,25 @@ import (
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/percona/rds_exporter/config"
 	"github.com/percona/rds_exporter/sessions"
 )
 
+// loadedSessions is a part of *sessions.Sessions used by Collector.
+type loadedSessions interface {
+	WatchLoaded(fn func(*session.Session, []sessions.Instance)) map[*session.Session][]sessions.Instance
+}
+
 // Collector collects enhanced RDS metrics by utilizing several scrapers.
 type Collector struct {
-	sessions *sessions.Sessions
-	logger   log.Logger
+	sessions loadedSessions
+	filter   valueFilter
+	logger   log.Logger // without component; it is added by scrapers
 
 	rw      sync.RWMutex
 	metrics map[string][]prometheus.Metric
@@ -28,43 +36,51 @@ const (
 	minInterval = 2 * time.Second
 )
 
-// NewCollector creates new collector and starts scrapers.
-func NewCollector(sessions *sessions.Sessions, logger log.Logger) *Collector {
+// NewCollector creates new collector and starts scrapers for sessions with loaded metadata.
+// Scrapers for sessions loaded later (for example, with asynchronous metadata loading) are started once they are loaded.
+// Metrics with values outside of ranges configured by metrics settings are not exposed.
+func NewCollector(sessions loadedSessions, metrics []config.EnhancedMetric, logger log.Logger) *Collector {
 	c := &Collector{
 		sessions: sessions,
-		logger:   log.With(logger, "component", "enhanced"),
+		filter:   newValueFilter(metrics),
+		logger:   logger,
 		metrics:  make(map[string][]prometheus.Metric),
 	}
 
-	for session, instances := range sessions.AllSessions() {
-		enabledInstances := getEnabledInstances(instances)
-		s := newScraper(session, enabledInstances, logger)
+	for session, instances := range sessions.WatchLoaded(c.startScraper) {
+		c.startScraper(session, instances)
+	}
 
-		interval := maxInterval
-		for _, instance := range enabledInstances {
-			if instance.EnhancedMonitoringInterval > 0 && instance.EnhancedMonitoringInterval < interval {
-				interval = instance.EnhancedMonitoringInterval
-			}
-		}
-		if interval < minInterval {
-			interval = minInterval
+	return c
+}
+
+// startScraper performs the first scrape of session's instances synchronously
+// (so collector has all metric descriptions), and then starts scraping them in background.
+func (c *Collector) startScraper(session *session.Session, instances []sessions.Instance) {
+	enabledInstances := getEnabledInstances(instances)
+	s := newScraper(session, enabledInstances, c.filter, c.logger)
+
+	interval := maxInterval
+	for _, instance := range enabledInstances {
+		if instance.EnhancedMonitoringInterval > 0 && instance.EnhancedMonitoringInterval < interval {
+			interval = instance.EnhancedMonitoringInterval
 		}
-		level.Info(s.logger).Log("msg", fmt.Sprintf("Updating enhanced metrics every %s.", interval))
-
-		// perform first scrapes synchronously so returned collector has all metric descriptions
-		m, _ := s.scrape(context.TODO())
-		c.setMetrics(m)
-
-		ch := make(chan map[string][]prometheus.Metric)
-		go func() {
-			for m := range ch {
-				c.setMetrics(m)
-			}
-		}()
-		go s.start(context.TODO(), interval, ch)
 	}
+	if interval < minInterval {
+		interval = minInterval
+	}
+	level.Info(s.logger).Log("msg", fmt.Sprintf("Updating enhanced metrics every %s.", interval))
 
-	return c
+	m, _ := s.scrape(context.TODO())
+	c.setMetrics(m)
+
+	ch := make(chan map[string][]prometheus.Metric)
+	go func() {
+		for m := range ch {
+			c.setMetrics(m)
+		}
+	}()
+	go s.start(context.TODO(), interval, ch)
 }
 
 func getEnabledInstances(instances []sessions.Instance) []sessions.Instance {
@@ -73,6 +89,10 @@ func getEnabledInstances(instances []sessions.Instance) []sessions.Instance {
 		if instance.DisableEnhancedMetrics {
 			continue
 		}
+		// instances without resource ID were not found in their region and have no log stream
+		if instance.ResourceID == "" {
+			continue
+		}
 		enabledInstances = append(enabledInstances, instance)
 	}
 
@@ -0,0 +1,73 @@
+package enhanced
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// fakeSessions has no loaded sessions at first; they are loaded by calling load.
+type fakeSessions struct {
+	load func(*session.Session, []sessions.Instance)
+}
+
+func (f *fakeSessions) WatchLoaded(fn func(*session.Session, []sessions.Instance)) map[*session.Session][]sessions.Instance {
+	f.load = fn
+	return nil
+}
+
+func TestCollectorLoadedLater(t *testing.T) {
+	message := readTestDataJSON(t, "mysql-57")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Logs_20140328.FilterLogEvents", r.Header.Get("X-Amz-Target"))
+
+		now := aws.TimeUnixMilli(time.Now())
+		b, err := json.Marshal(map[string]interface{}{
+			"events": []map[string]interface{}{{
+				"eventId":       "1",
+				"ingestionTime": now,
+				"logStreamName": "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+				"message":       string(message),
+				"timestamp":     now,
+			}},
+		})
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprint(w, string(b))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	fake := new(fakeSessions)
+	c := NewCollector(fake, nil, promlog.New(&promlog.Config{}))
+	assert.Equal(t, 0, testutil.CollectAndCount(c))
+
+	// metadata is loaded after collector construction, for example, after retries
+	require.NotNil(t, fake.load)
+	fake.load(sess, []sessions.Instance{{
+		Region:                     "us-west-2",
+		Instance:                   "autotest-mysql-57",
+		ResourceID:                 "db-QXZYJIL5GR3CBQ4XNCYU2AI5PE",
+		EnhancedMonitoringInterval: time.Minute,
+	}})
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "rdsosmetrics_General_numVCPUs"))
+}
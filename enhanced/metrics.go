@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
 )
 
 // osMetrics represents available Enhanced Monitoring OS metrics from CloudWatch Logs.
@@ -175,24 +178,56 @@ func parseOSMetrics(b []byte, disallowUnknownFields bool) (*osMetrics, error) {
 	return &m, nil
 }
 
-// makeGauge returns Prometheus gauge for given reflect.Value.
-func makeGauge(desc *prometheus.Desc, labelValues []string, value reflect.Value) prometheus.Metric {
-	// skip nil fields
+// valueFilter suppresses metrics with values outside of configured ranges.
+type valueFilter map[string]config.EnhancedMetric // metric name -> settings
+
+// newValueFilter returns filter for given metrics settings.
+func newValueFilter(metrics []config.EnhancedMetric) valueFilter {
+	res := make(valueFilter, len(metrics))
+	for _, m := range metrics {
+		res[m.Name] = m
+	}
+	return res
+}
+
+// skip returns true if metric with given name and value should not be exposed.
+func (f valueFilter) skip(name string, value reflect.Value) bool {
+	m, ok := f[name]
+	if !ok {
+		return false
+	}
+	v, ok := gaugeValue(value)
+	if !ok {
+		return false
+	}
+	return (m.MinValue != nil && v < *m.MinValue) || (m.MaxValue != nil && v > *m.MaxValue)
+}
+
+// gaugeValue returns gauge value for given reflect.Value, or false for nil fields.
+func gaugeValue(value reflect.Value) (float64, bool) {
 	if value.Kind() == reflect.Ptr {
 		if value.IsNil() {
-			return nil
+			return 0, false
 		}
 		value = value.Elem()
 	}
 
-	var f float64
 	switch kind := value.Kind(); kind {
 	case reflect.Float64:
-		f = value.Float()
+		return value.Float(), true
 	case reflect.Int, reflect.Int64:
-		f = float64(value.Int())
+		return float64(value.Int()), true
 	default:
-		panic(fmt.Errorf("can't make a metric value for %s from %v (%s)", desc, value, kind))
+		panic(fmt.Errorf("can't make a metric value from %v (%s)", value, kind))
+	}
+}
+
+// makeGauge returns Prometheus gauge for given reflect.Value.
+func makeGauge(desc *prometheus.Desc, labelValues []string, value reflect.Value) prometheus.Metric {
+	// skip nil fields
+	f, ok := gaugeValue(value)
+	if !ok {
+		return nil
 	}
 
 	return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, f, labelValues...)
@@ -384,8 +419,8 @@ func makeRDSNetworkMetrics(s *network, constLabels prometheus.Labels) []promethe
 	return res
 }
 
-// makeRDSProcessListMetrics returns rdsosmetrics_processList_ metrics.
-func makeRDSProcessListMetrics(s *processList, constLabels prometheus.Labels) []prometheus.Metric {
+// makeRDSProcessListMetrics returns rdsosmetrics_processList_ metrics except ones suppressed by filter.
+func makeRDSProcessListMetrics(s *processList, constLabels prometheus.Labels, filter valueFilter) []prometheus.Metric {
 	// move process name, ID, parent ID, thread ID to labels
 	labelKeys := []string{"name", "id", "parentID", "tgid"}
 	labelValues := []string{s.Name, strconv.Itoa(s.ID), strconv.Itoa(s.ParentID), strconv.Itoa(s.TGID)}
@@ -404,7 +439,10 @@ func makeRDSProcessListMetrics(s *processList, constLabels prometheus.Labels) []
 		case "name", "id", "parentID", "tgid":
 			continue
 		}
-		desc := prometheus.NewDesc("rdsosmetrics_processList_"+name, help, labelKeys, constLabels)
+		if filter.skip(config.EnhancedProcessListPrefix+name, v.Field(i)) {
+			continue
+		}
+		desc := prometheus.NewDesc(config.EnhancedProcessListPrefix+name, help, labelKeys, constLabels)
 		m := makeGauge(desc, labelValues, v.Field(i))
 		if m != nil {
 			res = append(res, m)
@@ -444,8 +482,8 @@ func makeNodeProcsMetrics(s *tasks, constLabels prometheus.Labels) []prometheus.
 	return res
 }
 
-// makePrometheusMetrics returns all Prometheus metrics for given osMetrics.
-func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]string) []prometheus.Metric {
+// makePrometheusMetrics returns all Prometheus metrics for given osMetrics except ones suppressed by filter.
+func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]string, filter valueFilter) []prometheus.Metric {
 	res := make([]prometheus.Metric, 0, 100)
 
 	constLabels := prometheus.Labels{
@@ -459,6 +497,9 @@ func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]strin
 			constLabels[n] = v
 		}
 	}
+	for n, v := range constLabels {
+		constLabels[n] = sessions.LimitLabelValue(v)
+	}
 
 	res = append(res, prometheus.MustNewConstMetric(
 		prometheus.NewDesc("rdsosmetrics_timestamp", "Metrics timestamp (UNIX seconds).", nil, constLabels),
@@ -512,7 +553,7 @@ func (m *osMetrics) makePrometheusMetrics(region string, labels map[string]strin
 	}
 
 	for _, p := range m.ProcessList {
-		metrics = makeRDSProcessListMetrics(&p, constLabels)
+		metrics = makeRDSProcessListMetrics(&p, constLabels, filter)
 		res = append(res, metrics...)
 		// no node_exporter-like metrics
 	}
@@ -5,8 +5,11 @@ import (
 	"testing"
 
 	"github.com/percona/exporter_shared/helpers"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/config"
 )
 
 func TestParse(t *testing.T) {
@@ -26,7 +29,7 @@ func TestParse(t *testing.T) {
 			m, err := parseOSMetrics(readTestDataJSON(t, data.instance), true)
 			require.NoError(t, err)
 
-			actualMetrics := helpers.ReadMetrics(m.makePrometheusMetrics(data.region, nil))
+			actualMetrics := helpers.ReadMetrics(m.makePrometheusMetrics(data.region, nil, nil))
 			sort.Slice(actualMetrics, func(i, j int) bool { return actualMetrics[i].Less(actualMetrics[j]) })
 			actualLines := helpers.Format(helpers.WriteMetrics(actualMetrics))
 
@@ -51,3 +54,28 @@ func TestParseUptime(t *testing.T) {
 	_ = "01:45:58"
 	_ = "1 day, 07:11:58"
 }
+
+func TestProcessListFilter(t *testing.T) {
+	minCPU := 1.0
+	filter := newValueFilter([]config.EnhancedMetric{{Name: "rdsosmetrics_processList_cpuUsedPc", MinValue: &minCPU}})
+
+	idle := &processList{Name: "idle", ID: 1, CPUUsedPC: 0.5, MemoryUsedPC: 2}
+	busy := &processList{Name: "busy", ID: 2, CPUUsedPC: 10, MemoryUsedPC: 2}
+	names := func(metrics []prometheus.Metric) []string {
+		var res []string
+		for _, m := range helpers.ReadMetrics(metrics) {
+			res = append(res, m.Name)
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	all := names(makeRDSProcessListMetrics(busy, nil, filter))
+	assert.Contains(t, all, "rdsosmetrics_processList_cpuUsedPc")
+	assert.Equal(t, all, names(makeRDSProcessListMetrics(idle, nil, nil)))
+
+	filtered := names(makeRDSProcessListMetrics(idle, nil, filter))
+	assert.NotContains(t, filtered, "rdsosmetrics_processList_cpuUsedPc")
+	assert.Contains(t, filtered, "rdsosmetrics_processList_memoryUsedPc")
+	assert.Len(t, filtered, len(all)-1)
+}
@@ -21,12 +21,13 @@ type scraper struct {
 	logStreamNames []string
 	svc            *cloudwatchlogs.CloudWatchLogs
 	nextStartTime  time.Time
+	filter         valueFilter
 	logger         log.Logger
 
 	testDisallowUnknownFields bool // for tests only
 }
 
-func newScraper(session *session.Session, instances []sessions.Instance, logger log.Logger) *scraper {
+func newScraper(session *session.Session, instances []sessions.Instance, filter valueFilter, logger log.Logger) *scraper {
 	logStreamNames := make([]string, 0, len(instances))
 	for _, instance := range instances {
 		logStreamNames = append(logStreamNames, instance.ResourceID)
@@ -37,6 +38,7 @@ func newScraper(session *session.Session, instances []sessions.Instance, logger
 		logStreamNames: logStreamNames,
 		svc:            cloudwatchlogs.New(session),
 		nextStartTime:  time.Now().Add(-3 * time.Minute).Round(0), // strip monotonic clock reading
+		filter:         filter,
 		logger:         log.With(logger, "component", "enhanced"),
 	}
 }
@@ -131,7 +133,7 @@ func (s *scraper) scrape(ctx context.Context) (map[string][]prometheus.Metric, m
 				if allMetrics[instance.ResourceID] == nil {
 					allMetrics[instance.ResourceID] = make(map[time.Time][]prometheus.Metric)
 				}
-				allMetrics[instance.ResourceID][timestamp] = osMetrics.makePrometheusMetrics(instance.Region, instance.Labels)
+				allMetrics[instance.ResourceID][timestamp] = osMetrics.makePrometheusMetrics(instance.Region, instance.ExpandedLabels(), s.filter)
 
 				if allMessages[instance.ResourceID] == nil {
 					allMessages[instance.ResourceID] = make(map[time.Time]string)
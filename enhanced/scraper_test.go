@@ -43,14 +43,14 @@ func TestScraper(t *testing.T) {
 	require.NoError(t, err)
 	logger := promlog.New(&promlog.Config{})
 	client := client.New(logger)
-	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false)
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false, false)
 	require.NoError(t, err)
 
 	for session, instances := range sess.AllSessions() {
 		session, instances := session, instances
 		t.Run(fmt.Sprint(instances), func(t *testing.T) {
 			// test that there are no new metrics
-			s := newScraper(session, instances, logger)
+			s := newScraper(session, instances, nil, logger)
 			s.testDisallowUnknownFields = true
 			metrics, messages := s.scrape(context.Background())
 			require.Len(t, metrics, len(instances))
@@ -74,7 +74,7 @@ func TestScraper(t *testing.T) {
 
 				osMetrics, err := parseOSMetrics(readTestDataJSON(t, instanceName), true)
 				require.NoError(t, err)
-				expectedMetrics := helpers.ReadMetrics(osMetrics.makePrometheusMetrics(instance.Region, nil))
+				expectedMetrics := helpers.ReadMetrics(osMetrics.makePrometheusMetrics(instance.Region, nil, nil))
 				sort.Slice(expectedMetrics, func(i, j int) bool { return expectedMetrics[i].Less(expectedMetrics[j]) })
 				expectedMetrics = filterMetrics(expectedMetrics)
 				expectedLines := helpers.Format(helpers.WriteMetrics(expectedMetrics))
@@ -149,7 +149,7 @@ func TestScraperDisableEnhancedMetrics(t *testing.T) {
 		isDisabled := i%2 == 0
 		cfg.Instances[i].DisableEnhancedMetrics = isDisabled
 	}
-	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false)
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, false, false)
 	require.NoError(t, err)
 
 	// Check if all collected metrics do not contain metrics for instance with disabled metrics.
@@ -165,7 +165,7 @@ func TestScraperDisableEnhancedMetrics(t *testing.T) {
 	for session, instances := range sess.AllSessions() {
 		session, instances := session, instances
 		t.Run(fmt.Sprint(instances), func(t *testing.T) {
-			s := newScraper(session, instances, logger)
+			s := newScraper(session, instances, nil, logger)
 			s.testDisallowUnknownFields = true
 			metrics, _ := s.scrape(context.Background())
 
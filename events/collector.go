@@ -0,0 +1,189 @@
+// Package events exposes RDS events as Prometheus counters.
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// allSessions is a part of *sessions.Sessions used by Collector.
+type allSessions interface {
+	AllSessions() map[*session.Session][]sessions.Instance
+}
+
+const (
+	// refreshInterval is a minimal interval between DescribeEvents requests; events have minute granularity,
+	// so more frequent scrapes are served from counts of the previous request.
+	refreshInterval = time.Minute
+
+	// requestTimeout limits DescribeEvents requests (with pagination) of a single refresh.
+	requestTimeout = 30 * time.Second
+)
+
+// Collector counts RDS events of configured instances by category.
+//
+// On scrape it requests events for the lookback window (at most once per refreshInterval)
+// and counts only those that were not seen before,
+// so overlapping windows of consecutive requests do not produce double counting.
+type Collector struct {
+	sessions allSessions
+	lookback time.Duration
+	l        log.Logger
+
+	refreshM  sync.Mutex // serializes refreshes of concurrent scrapes
+	refreshed time.Time  // time of the last refresh
+
+	m      sync.Mutex
+	seen   map[string]time.Time          // event key -> event time, for deduplication
+	counts map[string]map[string]float64 // region/instance -> category -> count
+}
+
+// New creates a new events collector.
+func New(sessions allSessions, lookback time.Duration, logger log.Logger) *Collector {
+	return &Collector{
+		sessions: sessions,
+		lookback: lookback,
+		l:        log.With(logger, "component", "events"),
+		seen:     make(map[string]time.Time),
+		counts:   make(map[string]map[string]float64),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	allSessions := c.sessions.AllSessions()
+	c.refresh(allSessions, time.Now())
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, instances := range allSessions {
+		for _, instance := range instances {
+			if instance.DisableBasicMetrics {
+				continue
+			}
+
+			counts := c.counts[instance.Region+"/"+instance.Instance]
+			if len(counts) == 0 {
+				continue
+			}
+
+			desc := prometheus.NewDesc("rds_events_total", "Total number of RDS events by category.", []string{"category"}, instance.ConstLabels())
+			for category, count := range counts {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, count, category)
+			}
+		}
+	}
+}
+
+// refresh requests events for all sessions unless they were requested less than refreshInterval ago.
+func (c *Collector) refresh(allSessions map[*session.Session][]sessions.Instance, now time.Time) {
+	c.refreshM.Lock()
+	defer c.refreshM.Unlock()
+
+	if now.Sub(c.refreshed) < refreshInterval {
+		return
+	}
+	c.refreshed = now
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for session, instances := range allSessions {
+		session, instances := session, instances
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			svc := rds.New(session)
+			input := &rds.DescribeEventsInput{
+				SourceType: aws.String(rds.SourceTypeDbInstance),
+				StartTime:  aws.Time(now.Add(-c.lookback)),
+				EndTime:    aws.Time(now),
+			}
+			var events []*rds.Event
+			err := svc.DescribeEventsPagesWithContext(ctx, input, func(output *rds.DescribeEventsOutput, lastPage bool) bool {
+				events = append(events, output.Events...)
+				return true // continue pagination
+			})
+			if err != nil {
+				level.Error(c.l).Log("msg", "Failed to describe events.", "region", aws.StringValue(session.Config.Region), "error", err)
+				return
+			}
+			c.add(instances, events)
+		}()
+	}
+	wg.Wait()
+
+	c.m.Lock()
+	c.forget(now.Add(-c.lookback))
+	c.m.Unlock()
+}
+
+// add counts events of given instances that were not seen before.
+func (c *Collector) add(instances []sessions.Instance, events []*rds.Event) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, event := range events {
+		sourceID := aws.StringValue(event.SourceIdentifier)
+		var instance *sessions.Instance
+		for _, i := range instances {
+			if i.Instance == sourceID {
+				instance = &i
+				break
+			}
+		}
+		if instance == nil {
+			continue
+		}
+
+		date := aws.TimeValue(event.Date)
+		key := fmt.Sprintf("%s/%s/%d/%s", instance.Region, sourceID, date.UnixNano(), aws.StringValue(event.Message))
+		if _, ok := c.seen[key]; ok {
+			continue
+		}
+		c.seen[key] = date
+
+		id := instance.Region + "/" + instance.Instance
+		if c.counts[id] == nil {
+			c.counts[id] = make(map[string]float64)
+		}
+		for _, category := range event.EventCategories {
+			c.counts[id][aws.StringValue(category)]++
+		}
+	}
+}
+
+// forget removes deduplication information for events older than given time;
+// they can't be returned again for the lookback window.
+// Must be called with c.m held.
+func (c *Collector) forget(before time.Time) {
+	for key, date := range c.seen {
+		if date.Before(before) {
+			delete(c.seen, key)
+		}
+	}
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+)
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+func TestCollectorAdd(t *testing.T) {
+	c := New(nil, time.Hour, promlog.New(&promlog.Config{}))
+	instances := []sessions.Instance{{Region: "us-east-1", Instance: "db1"}}
+	now := time.Now()
+
+	events := []*rds.Event{{
+		Date:             aws.Time(now.Add(-time.Minute)),
+		EventCategories:  aws.StringSlice([]string{"failover", "notification"}),
+		Message:          aws.String("Multi-AZ instance failover started."),
+		SourceIdentifier: aws.String("db1"),
+	}, {
+		Date:             aws.Time(now.Add(-time.Minute)),
+		EventCategories:  aws.StringSlice([]string{"maintenance"}),
+		Message:          aws.String("Database instance patched."),
+		SourceIdentifier: aws.String("db1"),
+	}, {
+		Date:             aws.Time(now.Add(-time.Minute)),
+		EventCategories:  aws.StringSlice([]string{"failure"}),
+		Message:          aws.String("Not configured."),
+		SourceIdentifier: aws.String("db2"),
+	}}
+
+	// overlapping windows return the same events again
+	c.add(instances, events)
+	c.add(instances, events)
+	c.add(instances, append(events, &rds.Event{
+		Date:             aws.Time(now),
+		EventCategories:  aws.StringSlice([]string{"failover"}),
+		Message:          aws.String("Multi-AZ instance failover completed."),
+		SourceIdentifier: aws.String("db1"),
+	}))
+
+	expected := map[string]map[string]float64{
+		"us-east-1/db1": {
+			"failover":     2,
+			"notification": 1,
+			"maintenance":  1,
+		},
+	}
+	assert.Equal(t, expected, c.counts)
+
+	c.forget(now.Add(-time.Second))
+	assert.Len(t, c.seen, 1)
+}
+
+// fakeSessions returns fixed sessions.
+type fakeSessions map[*session.Session][]sessions.Instance
+
+func (s fakeSessions) AllSessions() map[*session.Session][]sessions.Instance {
+	return s
+}
+
+func TestCollectorRefresh(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "DescribeEvents", r.Form.Get("Action"))
+		atomic.AddInt32(&requests, 1)
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<DescribeEventsResponse xmlns="http://rds.amazonaws.com/doc/2014-10-31/">
+  <DescribeEventsResult>
+    <Events>
+      <Event>
+        <SourceIdentifier>db1</SourceIdentifier>
+        <SourceType>db-instance</SourceType>
+        <EventCategories><EventCategory>failover</EventCategory></EventCategories>
+        <Message>Multi-AZ instance failover started.</Message>
+        <Date>%s</Date>
+      </Event>
+    </Events>
+  </DescribeEventsResult>
+  <ResponseMetadata><RequestId>test</RequestId></ResponseMetadata>
+</DescribeEventsResponse>`, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	require.NoError(t, err)
+	c := New(fakeSessions{sess: {{Region: "us-east-1", Instance: "db1"}}}, time.Hour, promlog.New(&promlog.Config{}))
+
+	expected := `# HELP rds_events_total Total number of RDS events by category.
+# TYPE rds_events_total counter
+rds_events_total{category="failover",instance="db1",region="us-east-1"} 1
+`
+
+	// scrapes within refresh interval are served from counts
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the same event is not counted again after refresh
+	c.refreshed = c.refreshed.Add(-refreshInterval)
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -18,17 +22,49 @@ import (
 	"github.com/percona/rds_exporter/client"
 	"github.com/percona/rds_exporter/config"
 	"github.com/percona/rds_exporter/enhanced"
+	"github.com/percona/rds_exporter/events"
+	"github.com/percona/rds_exporter/metadata"
+	"github.com/percona/rds_exporter/quotas"
 	"github.com/percona/rds_exporter/sessions"
+	"github.com/percona/rds_exporter/sink"
 )
 
 //nolint:lll
 var (
-	listenAddressF       = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9042").String()
-	basicMetricsPathF    = kingpin.Flag("web.basic-telemetry-path", "Path under which to expose exporter's basic metrics.").Default("/basic").String()
-	enhancedMetricsPathF = kingpin.Flag("web.enhanced-telemetry-path", "Path under which to expose exporter's enhanced metrics.").Default("/enhanced").String()
-	configFileF          = kingpin.Flag("config.file", "Path to configuration file.").Default("config.yml").String()
-	logTraceF            = kingpin.Flag("log.trace", "Enable verbose tracing of AWS requests (will log credentials).").Default("false").Bool()
-	logger               = log.NewNopLogger()
+	listenAddressF        = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9042").String()
+	basicMetricsPathF     = kingpin.Flag("web.basic-telemetry-path", "Path under which to expose exporter's basic metrics.").Default("/basic").String()
+	enhancedMetricsPathF  = kingpin.Flag("web.enhanced-telemetry-path", "Path under which to expose exporter's enhanced metrics.").Default("/enhanced").String()
+	debugStateF           = kingpin.Flag("web.debug-state", "Expose JSON dump of exporter's state on /debug/state for troubleshooting.").Default("false").Bool()
+	configFileF           = kingpin.Flag("config.file", "Path to configuration file.").Default("config.yml").String()
+	logTraceF             = kingpin.Flag("log.trace", "Enable verbose tracing of AWS requests (will log credentials).").Default("false").Bool()
+	awsDebugRequestsF     = kingpin.Flag("aws.debug-requests", "Log AWS requests and responses at debug level, with sensitive headers redacted.").Default("false").Bool()
+	shardF                = kingpin.Flag("shard", "Shard number of this exporter replica, from 0 to --total-shards - 1.").Default("0").Int()
+	totalShardsF          = kingpin.Flag("total-shards", "Total number of exporter replicas splitting configured instances.").Default("1").Int()
+	metadataRetryInitialF = kingpin.Flag("metadata.retry-initial-interval", "Initial interval between retries of failed initial instances metadata loading.").Default("1s").Duration()
+	metadataRetryMaxF     = kingpin.Flag("metadata.retry-max-interval", "Maximal interval between retries of failed initial instances metadata loading.").Default("5m").Duration()
+	asyncMetadataF        = kingpin.Flag("metadata.async-startup", "Do not wait for initial instances metadata at startup; collect CloudWatch metrics while it is loaded.").Default("false").Bool()
+	metadataRefreshF      = kingpin.Flag("metadata.refresh-interval", "Interval between instances metadata refreshes, 0 disables them.").Default("30m").Duration()
+	maxLabelValueLengthF  = kingpin.Flag("labels.max-value-length", "Maximum length of label values; longer ones are truncated with a hash suffix, 0 means no limit.").Default("0").Int()
+	scrapeTimeoutF        = kingpin.Flag("basic.scrape-timeout", "Maximum duration of basic metrics collection; running CloudWatch requests are canceled after it, 0 means no limit.").Default("0").Duration()
+	regionConcurrencyF    = kingpin.Flag("basic.region-concurrency", "Maximum number of regions scraped concurrently for basic metrics, 0 means no limit.").Default("0").Int()
+	notFoundF             = kingpin.Flag("metadata.not-found", "Behavior for instances not found by DescribeDBInstances in their configured region: skip or warn (scrape without metadata).").Default(sessions.NotFoundSkip).Enum(sessions.NotFoundSkip, sessions.NotFoundWarn)
+	backgroundIntervalF   = kingpin.Flag("basic.background-interval", "Collect basic metrics in background with this interval and serve the latest snapshot, 0 disables.").Default("0").Duration()
+	prefetchLeadF         = kingpin.Flag("basic.prefetch-lead", "How long before the background snapshot becomes stale to start collecting the next one.").Default("10s").Duration()
+	getMetricDataF        = kingpin.Flag("basic.get-metric-data", "Request basic metrics of each instance with batched GetMetricData calls instead of one GetMetricStatistics call per metric.").Default("false").Bool()
+	cloudWatchTimestampsF = kingpin.Flag("basic.cloudwatch-timestamps", "Expose basic metrics with CloudWatch datapoints timestamps instead of scrape time.").Default("false").Bool()
+	coldThresholdF        = kingpin.Flag("basic.cold-threshold", "Number of consecutive scrapes without datapoints after which instance is considered cold, 0 disables detection.").Default("0").Int()
+	coldScrapeEveryF      = kingpin.Flag("basic.cold-scrape-every", "Scrape cold instances only once in that number of collections.").Default("1").Int()
+	staleMaxAgeF          = kingpin.Flag("basic.stale-max-age", "Send the last good basic metric value with stale=\"true\" label for that long when CloudWatch requests fail, 0 disables.").Default("0").Duration()
+	predictStorageFullF   = kingpin.Flag("basic.predict-storage-full", "Expose rds_predicted_storage_full_seconds metric estimated from FreeStorageSpace trend.").Default("false").Bool()
+	eventsEnabledF        = kingpin.Flag("events.enabled", "Expose counters of RDS events by category on basic metrics path.").Default("false").Bool()
+	eventsLookbackF       = kingpin.Flag("events.lookback", "Lookback window for RDS events requests.").Default("1h").Duration()
+	certificatesEnabledF  = kingpin.Flag("certificates.enabled", "Expose rds_certificate_rotation_pending metric on basic metrics path.").Default("false").Bool()
+	certificatesIntervalF = kingpin.Flag("certificates.refresh-interval", "Interval between available CA certificates refreshes.").Default("24h").Duration()
+	quotasEnabledF        = kingpin.Flag("quotas.enabled", "Expose CloudWatch API quotas from AWS Service Quotas on basic metrics path.").Default("false").Bool()
+	quotasIntervalF       = kingpin.Flag("quotas.refresh-interval", "Interval between CloudWatch API quotas refreshes.").Default("24h").Duration()
+	outputFileF           = kingpin.Flag("output.file", "Path to file where all metrics are periodically written in OpenMetrics text format. Disabled if empty.").Default("").String()
+	outputIntervalF       = kingpin.Flag("output.interval", "Interval between writes of output file. Without --basic.background-interval every write makes a full CloudWatch scrape.").Default("60s").Duration()
+	logger                = log.NewNopLogger()
 )
 
 func main() {
@@ -46,18 +82,75 @@ func main() {
 		level.Error(logger).Log("msg", "Can't read configuration file", "error", err)
 		os.Exit(1)
 	}
+	if err = cfg.FilterShard(*shardF, *totalShardsF); err != nil {
+		level.Error(logger).Log("msg", "Invalid sharding flags", "error", err)
+		os.Exit(1)
+	}
+	if *totalShardsF > 1 {
+		level.Info(logger).Log("msg", fmt.Sprintf("Using %d instances of shard %d/%d.", len(cfg.Instances), *shardF, *totalShardsF))
+	}
+	if *backgroundIntervalF > 0 && (*prefetchLeadF < 0 || *prefetchLeadF >= *backgroundIntervalF) {
+		level.Error(logger).Log("msg", fmt.Sprintf("Invalid --basic.prefetch-lead %s: should be non-negative and less than --basic.background-interval %s.", *prefetchLeadF, *backgroundIntervalF))
+		os.Exit(1)
+	}
+
+	sessions.MetadataRetryInitialInterval = *metadataRetryInitialF
+	sessions.MetadataRetryMaxInterval = *metadataRetryMaxF
+	sessions.MaxLabelValueLength = *maxLabelValueLengthF
+	sessions.AsyncMetadata = *asyncMetadataF
+	sessions.NotFound = *notFoundF
 
 	client := client.New(logger)
-	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, *logTraceF)
+	sess, err := sessions.New(cfg.Instances, client.HTTP(), logger, *logTraceF, *awsDebugRequestsF)
 	if err != nil {
 		level.Error(logger).Log("msg", "Can't create sessions", "error", err)
 		os.Exit(1)
 	}
+	if *metadataRefreshF > 0 {
+		go sess.StartRefresh(context.Background(), *metadataRefreshF)
+	}
 
-	// basic metrics + client metrics + exporter own metrics (ProcessCollector and GoCollector)
+	// basic metrics + client metrics + sessions and metadata metrics + events and quotas metrics + exporter own metrics (ProcessCollector and GoCollector)
+	basic.PredictStorageFull = *predictStorageFullF
+	basic.StaleMaxAge = *staleMaxAgeF
+	basic.ColdThreshold = *coldThresholdF
+	basic.ColdScrapeEvery = *coldScrapeEveryF
+	basic.CloudWatchTimestamps = *cloudWatchTimestampsF
+	basic.UseGetMetricData = *getMetricDataF
+	basic.RegionConcurrency = *regionConcurrencyF
+	basic.ScrapeTimeout = *scrapeTimeoutF
+	basicCollector := basic.New(cfg, sess, logger)
 	{
-		prometheus.MustRegister(basic.New(cfg, sess, logger))
+		if *backgroundIntervalF > 0 {
+			p := basic.NewPrefetcher(basicCollector, logger)
+			go p.Run(context.Background(), *backgroundIntervalF, *prefetchLeadF)
+			prometheus.MustRegister(p)
+		} else {
+			prometheus.MustRegister(basicCollector)
+		}
 		prometheus.MustRegister(client)
+		prometheus.MustRegister(sess)
+		instanceShard := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rds_exporter_instance_shard",
+			Help: "Shard number the instance belongs to.",
+		}, []string{"region", "instance"})
+		for _, instance := range cfg.Instances {
+			instanceShard.WithLabelValues(instance.Region, instance.Instance).Set(float64(*shardF))
+		}
+		prometheus.MustRegister(instanceShard)
+		if *eventsEnabledF {
+			prometheus.MustRegister(events.New(sess, *eventsLookbackF, logger))
+		}
+		metadataCollector := metadata.New(sess, cfg.MinEngineVersions, logger)
+		prometheus.MustRegister(metadataCollector)
+		if *certificatesEnabledF {
+			go metadataCollector.StartCertificates(context.Background(), *certificatesIntervalF)
+		}
+		if *quotasEnabledF {
+			q := quotas.New(sess, logger)
+			go q.Start(context.Background(), *quotasIntervalF)
+			prometheus.MustRegister(q)
+		}
 		http.Handle(*basicMetricsPathF, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
 			//ErrorLog:      log.NewErrorLogger(), TODO TS
 			ErrorHandling: promhttp.ContinueOnError,
@@ -65,15 +158,54 @@ func main() {
 	}
 
 	// enhanced metrics
+	enhancedRegistry := prometheus.NewRegistry()
 	{
-		registry := prometheus.NewRegistry()
-		registry.MustRegister(enhanced.NewCollector(sess, logger))
-		http.Handle(*enhancedMetricsPathF, promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		enhancedRegistry.MustRegister(enhanced.NewCollector(sess, cfg.EnhancedMetrics, logger))
+		http.Handle(*enhancedMetricsPathF, promhttp.HandlerFor(enhancedRegistry, promhttp.HandlerOpts{
 			//ErrorLog:      log.NewErrorLogger(), TODO TS
 			ErrorHandling: promhttp.ContinueOnError,
 		}))
 	}
 
+	// diagnostic state of basic metrics scraping and instances metadata
+	if *debugStateF {
+		http.HandleFunc("/debug/state", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			e := json.NewEncoder(w)
+			e.SetIndent("", "  ")
+			if err := e.Encode(map[string]interface{}{"instances": basicCollector.State()}); err != nil {
+				level.Error(logger).Log("msg", "Failed to write state.", "error", err)
+			}
+		})
+		level.Info(logger).Log("msg", fmt.Sprintf("Debug state     : http://%s/debug/state", *listenAddressF))
+	}
+
+	// all metrics to file for environments where exporter can't be scraped directly
+	if *outputFileF != "" {
+		f := sink.NewFile(*outputFileF, prometheus.Gatherers{prometheus.DefaultGatherer, enhancedRegistry}, logger)
+		go f.Run(context.Background(), *outputIntervalF)
+		level.Info(logger).Log("msg", fmt.Sprintf("Writing metrics to %s every %s.", *outputFileF, *outputIntervalF))
+		if *backgroundIntervalF == 0 {
+			level.Warn(logger).Log("msg", "Every output file write makes a full CloudWatch scrape in addition to HTTP scrapes; "+
+				"set --basic.background-interval to write the latest snapshot instead.")
+		}
+	}
+
+	// reload basic metrics settings on SIGHUP
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			newCfg, err := config.Load(*configFileF)
+			if err != nil {
+				level.Error(logger).Log("msg", "Can't reload configuration file, keeping previous metrics settings.", "error", err)
+				continue
+			}
+			basicCollector.SetMetricsConfig(newCfg)
+			level.Info(logger).Log("msg", "Reloaded metrics settings. Changes in instances require restart.")
+		}
+	}()
+
 	level.Info(logger).Log("msg", fmt.Sprintf("Basic metrics   : http://%s%s", *listenAddressF, *basicMetricsPathF))
 	level.Info(logger).Log("msg", fmt.Sprintf("Enhanced metrics: http://%s%s", *listenAddressF, *enhancedMetricsPathF))
 
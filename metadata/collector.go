@@ -0,0 +1,319 @@
+// Package metadata exposes metrics derived from RDS instances metadata.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/config"
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// Collector exposes metrics derived from cached instances metadata
+// and periodically refreshed information about available CA certificates.
+type Collector struct {
+	sessions          *sessions.Sessions
+	minEngineVersions map[string][]int // engine -> parsed minimal version
+	l                 log.Logger
+
+	rw           sync.RWMutex
+	certificates map[string][]*rds.Certificate // region -> available CA certificates
+}
+
+// New creates a new metadata collector.
+// minEngineVersions are validated minimal engine versions from configuration file.
+func New(sessions *sessions.Sessions, minEngineVersions map[string]string, logger log.Logger) *Collector {
+	c := &Collector{
+		sessions:          sessions,
+		minEngineVersions: make(map[string][]int, len(minEngineVersions)),
+		l:                 log.With(logger, "component", "metadata"),
+		certificates:      make(map[string][]*rds.Certificate),
+	}
+	for engine, version := range minEngineVersions {
+		v, err := config.ParseEngineVersion(version)
+		if err != nil {
+			level.Error(c.l).Log("msg", fmt.Sprintf("Invalid minimal version for %s, skipping.", engine), "error", err)
+			continue
+		}
+		c.minEngineVersions[engine] = v
+	}
+	return c
+}
+
+// StartCertificates refreshes available CA certificates every interval until context is canceled.
+func (c *Collector) StartCertificates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.refreshCertificates(ctx)
+
+		select {
+		case <-ticker.C:
+			// nothing
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshCertificates loads available CA certificates for all regions,
+// keeping previous ones for regions where that failed.
+func (c *Collector) refreshCertificates(ctx context.Context) {
+	for session, instances := range c.sessions.AllSessions() {
+		var certificates []*rds.Certificate
+		err := rds.New(session).DescribeCertificatesPagesWithContext(ctx, new(rds.DescribeCertificatesInput),
+			func(output *rds.DescribeCertificatesOutput, lastPage bool) bool {
+				certificates = append(certificates, output.Certificates...)
+				return true // continue pagination
+			})
+		region := aws.StringValue(session.Config.Region)
+		if err != nil {
+			level.Error(c.l).Log("msg", "Failed to describe certificates.", "region", region, "error", err)
+			continue
+		}
+		level.Debug(c.l).Log("msg", fmt.Sprintf("Loaded %d certificates for %d instances.", len(certificates), len(instances)), "region", region)
+
+		c.rw.Lock()
+		c.certificates[region] = certificates
+		c.rw.Unlock()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	// unchecked collector
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	for _, instances := range c.sessions.AllSessions() {
+		for _, instance := range instances {
+			if instance.DisableBasicMetrics {
+				continue
+			}
+
+			constLabels := instance.ConstLabels()
+
+			now := time.Now().UTC()
+			for _, w := range []struct {
+				name string
+				help string
+				spec string
+			}{
+				{"rds_maintenance_window_active", "1 during instance's preferred maintenance window, 0 otherwise.", instance.MaintenanceWindow},
+				{"rds_backup_window_active", "1 during instance's preferred backup window, 0 otherwise.", instance.BackupWindow},
+			} {
+				if w.spec == "" {
+					continue
+				}
+				active, err := windowActive(w.spec, now)
+				if err != nil {
+					level.Error(c.l).Log("msg", fmt.Sprintf("Failed to parse window for %s.", instance), "error", err)
+					continue
+				}
+				v := 0.0
+				if active {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc(w.name, w.help, nil, constLabels),
+					prometheus.GaugeValue,
+					v,
+				)
+			}
+
+			if min := c.minEngineVersions[instance.Engine]; min != nil && instance.EngineVersion != "" {
+				if v, err := config.ParseEngineVersion(instance.EngineVersion); err != nil {
+					level.Error(c.l).Log("msg", fmt.Sprintf("Failed to parse engine version of %s.", instance), "error", err)
+				} else {
+					outdated := 0.0
+					if config.CompareEngineVersions(v, min) < 0 {
+						outdated = 1
+					}
+					ch <- prometheus.MustNewConstMetric(
+						prometheus.NewDesc(
+							"rds_engine_version_outdated",
+							"1 if instance's engine version is lower than the minimal one from configuration file, 0 otherwise.",
+							[]string{"engine_version"}, constLabels,
+						),
+						prometheus.GaugeValue,
+						outdated,
+						instance.EngineVersion,
+					)
+				}
+			}
+
+			for _, field := range instance.PendingModifications {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc(
+						"rds_pending_modification",
+						"Instance's pending modification that will be applied later, often during the next maintenance window; always 1.",
+						[]string{"field"}, constLabels,
+					),
+					prometheus.GaugeValue,
+					1,
+					field,
+				)
+			}
+
+			if usesOptionGroups(instance.Engine) {
+				for _, group := range instance.OptionGroups {
+					ch <- prometheus.MustNewConstMetric(
+						prometheus.NewDesc(
+							"rds_option_group_status",
+							"Instance's option group membership status; always 1.",
+							[]string{"group", "status"}, constLabels,
+						),
+						prometheus.GaugeValue,
+						1,
+						sessions.LimitLabelValue(group.Name), group.Status,
+					)
+				}
+			}
+
+			if certificates := c.certificates[instance.Region]; len(certificates) > 0 {
+				v := 0.0
+				if rotationPending(instance.CACertificateIdentifier, certificates, now) {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc(
+						"rds_certificate_rotation_pending",
+						"1 if the instance's CA certificate is behind the default one (or a newer CA generation is available), 0 otherwise.",
+						[]string{"ca_certificate"}, constLabels,
+					),
+					prometheus.GaugeValue,
+					v,
+					instance.CACertificateIdentifier,
+				)
+			}
+		}
+	}
+}
+
+// usesOptionGroups returns true if options groups can be configured for the given engine.
+// Other engines (PostgreSQL, Aurora) have only default ones.
+func usesOptionGroups(engine string) bool {
+	for _, prefix := range []string{"mysql", "mariadb", "oracle", "sqlserver"} {
+		if strings.HasPrefix(engine, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdays are prefixes of maintenance window bounds.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// parseWindowBound parses "ddd:hh24:mi" or "hh24:mi" to minutes since the start of week or day.
+func parseWindowBound(s string) (int, bool, error) {
+	weekly := false
+	minutes := 0
+	if len(s) == len("ddd:hh:mm") {
+		day := -1
+		for i, d := range weekdays {
+			if strings.EqualFold(s[:3], d) {
+				day = i
+			}
+		}
+		if day < 0 || s[3] != ':' {
+			return 0, false, fmt.Errorf("invalid window bound %q", s)
+		}
+		weekly = true
+		minutes = day * 24 * 60
+		s = s[4:]
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid window bound %q: %s", s, err)
+	}
+	return minutes + t.Hour()*60 + t.Minute(), weekly, nil
+}
+
+// windowActive returns true if the given time is in a weekly ("ddd:hh24:mi-ddd:hh24:mi")
+// or daily ("hh24:mi-hh24:mi") UTC window.
+func windowActive(spec string, now time.Time) (bool, error) {
+	bounds := strings.Split(spec, "-")
+	if len(bounds) != 2 {
+		return false, fmt.Errorf("invalid window %q", spec)
+	}
+	start, startWeekly, err := parseWindowBound(bounds[0])
+	if err != nil {
+		return false, err
+	}
+	end, endWeekly, err := parseWindowBound(bounds[1])
+	if err != nil {
+		return false, err
+	}
+	if startWeekly != endWeekly {
+		return false, fmt.Errorf("invalid window %q", spec)
+	}
+
+	now = now.UTC()
+	current := now.Hour()*60 + now.Minute()
+	if startWeekly {
+		current += int(now.Weekday()) * 24 * 60
+	}
+
+	if start <= end {
+		return current >= start && current < end, nil
+	}
+	// window wraps around the end of week or day
+	return current >= start || current < end, nil
+}
+
+// newerCertificateThreshold is a minimal difference in ValidFrom times of certificates of different generations.
+// Certificates of the same generation (for example, RSA 2048 and RSA 4096 ones) are issued at nearly the same time.
+const newerCertificateThreshold = 30 * 24 * time.Hour
+
+// rotationPending returns true if the instance's CA certificate is behind the account's default one.
+//
+// If the account has a customer override of the default certificate (CustomerOverride in DescribeCertificates
+// output, not expired), rotation is pending for instances with a different certificate issued before the overriding one.
+// Otherwise, the default is not reported by the AWS SDK version used, so rotation is pending if there is
+// a certificate of a newer generation: issued more than newerCertificateThreshold later and valid longer.
+func rotationPending(identifier string, certificates []*rds.Certificate, now time.Time) bool {
+	var current, override *rds.Certificate
+	for _, cert := range certificates {
+		if aws.StringValue(cert.CertificateIdentifier) == identifier {
+			current = cert
+		}
+		if aws.BoolValue(cert.CustomerOverride) && (cert.CustomerOverrideValidTill == nil || now.Before(*cert.CustomerOverrideValidTill)) {
+			override = cert
+		}
+	}
+	if current == nil {
+		return false
+	}
+
+	if override != nil {
+		return override != current && aws.TimeValue(current.ValidFrom).Before(aws.TimeValue(override.ValidFrom))
+	}
+
+	for _, cert := range certificates {
+		newer := aws.TimeValue(cert.ValidFrom).Sub(aws.TimeValue(current.ValidFrom)) > newerCertificateThreshold
+		if newer && aws.TimeValue(cert.ValidTill).After(aws.TimeValue(current.ValidTill)) {
+			return true
+		}
+	}
+	return false
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+)
@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsesOptionGroups(t *testing.T) {
+	for _, engine := range []string{"mysql", "mariadb", "oracle-ee", "oracle-se2-cdb", "sqlserver-se", "sqlserver-ex"} {
+		assert.True(t, usesOptionGroups(engine), engine)
+	}
+	for _, engine := range []string{"postgres", "aurora", "aurora-mysql", "aurora-postgresql", ""} {
+		assert.False(t, usesOptionGroups(engine), engine)
+	}
+}
+
+func TestRotationPending(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			panic(err)
+		}
+		return aws.Time(d)
+	}
+	certificates := []*rds.Certificate{{
+		CertificateIdentifier: aws.String("rds-ca-2019"),
+		ValidFrom:             date("2019-09-19"),
+		ValidTill:             date("2024-08-22"),
+	}, {
+		CertificateIdentifier: aws.String("rds-ca-rsa2048-g1"),
+		ValidFrom:             date("2021-05-25"),
+		ValidTill:             date("2061-05-25"),
+	}, {
+		CertificateIdentifier: aws.String("rds-ca-rsa4096-g1"),
+		ValidFrom:             date("2021-05-26"),
+		ValidTill:             date("2121-05-26"),
+	}}
+
+	now := *date("2023-06-01")
+	assert.True(t, rotationPending("rds-ca-2019", certificates, now))
+	assert.False(t, rotationPending("rds-ca-rsa2048-g1", certificates, now))
+	assert.False(t, rotationPending("rds-ca-rsa4096-g1", certificates, now))
+	assert.False(t, rotationPending("unknown", certificates, now))
+
+	t.Run("Threshold", func(t *testing.T) {
+		current := &rds.Certificate{
+			CertificateIdentifier: aws.String("current"),
+			ValidFrom:             date("2021-01-01"),
+			ValidTill:             date("2031-01-01"),
+		}
+		candidate := func(validFrom time.Time) []*rds.Certificate {
+			return []*rds.Certificate{current, {
+				CertificateIdentifier: aws.String("candidate"),
+				ValidFrom:             aws.Time(validFrom),
+				ValidTill:             date("2061-01-01"),
+			}}
+		}
+
+		// exactly at threshold is the same generation
+		assert.False(t, rotationPending("current", candidate(current.ValidFrom.Add(newerCertificateThreshold)), now))
+		assert.True(t, rotationPending("current", candidate(current.ValidFrom.Add(newerCertificateThreshold+time.Second)), now))
+	})
+
+	t.Run("CustomerOverride", func(t *testing.T) {
+		override := []*rds.Certificate{{
+			CertificateIdentifier: aws.String("rds-ca-2019"),
+			ValidFrom:             date("2019-09-19"),
+			ValidTill:             date("2024-08-22"),
+			CustomerOverride:      aws.Bool(true),
+		}, certificates[1], certificates[2]}
+
+		// the account keeps the old default: newer certificates are not required
+		assert.False(t, rotationPending("rds-ca-2019", override, now))
+		assert.False(t, rotationPending("rds-ca-rsa2048-g1", override, now))
+
+		// the account switched the default to the RSA 4096 one: older certificates are behind it
+		override[0] = certificates[0]
+		override[2] = &rds.Certificate{
+			CertificateIdentifier:     aws.String("rds-ca-rsa4096-g1"),
+			ValidFrom:                 date("2021-05-26"),
+			ValidTill:                 date("2121-05-26"),
+			CustomerOverride:          aws.Bool(true),
+			CustomerOverrideValidTill: date("2024-01-01"),
+		}
+		assert.True(t, rotationPending("rds-ca-2019", override, now))
+		assert.True(t, rotationPending("rds-ca-rsa2048-g1", override, now))
+		assert.False(t, rotationPending("rds-ca-rsa4096-g1", override, now))
+
+		// expired override is ignored
+		assert.False(t, rotationPending("rds-ca-rsa2048-g1", override, *date("2024-02-01")))
+	})
+}
+
+func TestWindowActive(t *testing.T) {
+	// 2020-06-07 is Sunday
+	now := time.Date(2020, 6, 7, 5, 10, 0, 0, time.UTC)
+
+	for spec, expected := range map[string]bool{
+		"sun:05:00-sun:05:30": true,
+		"Sun:05:10-Sun:05:30": true,
+		"sun:05:30-sun:06:00": false,
+		"sun:04:30-sun:05:10": false,
+		"sat:23:00-mon:00:00": true,
+		"sat:23:00-sat:23:30": false,
+		"05:00-05:30":         true,
+		"23:00-05:20":         true,
+		"23:00-05:00":         false,
+	} {
+		actual, err := windowActive(spec, now)
+		assert.NoError(t, err, spec)
+		assert.Equal(t, expected, actual, spec)
+	}
+
+	for _, spec := range []string{"", "sun:05:00", "foo:05:00-sun:05:30", "sun:05:00-05:30", "25:00-26:00"} {
+		_, err := windowActive(spec, now)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,172 @@
+// Package quotas exposes AWS Service Quotas of CloudWatch APIs used by the exporter.
+package quotas
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/servicequotas/servicequotasiface"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/percona/rds_exporter/sessions"
+)
+
+// cloudWatchServiceCode is a Service Quotas code of CloudWatch.
+const cloudWatchServiceCode = "monitoring"
+
+// apis are CloudWatch APIs used by the exporter; quotas with names containing them are exposed.
+var apis = []string{"GetMetricData", "GetMetricStatistics"}
+
+var limitDesc = prometheus.NewDesc(
+	"rds_exporter_cloudwatch_quota_limit",
+	"CloudWatch API quota value from AWS Service Quotas.",
+	[]string{"region", "api", "quota_code", "quota_name"},
+	nil,
+)
+
+type quota struct {
+	region string
+	api    string
+	code   string
+	name   string
+	value  float64
+}
+
+// Collector periodically loads CloudWatch quotas for all regions and exposes them.
+type Collector struct {
+	sessions *sessions.Sessions
+	l        log.Logger
+
+	rw     sync.RWMutex
+	quotas map[string][]quota // region -> quotas
+}
+
+// New creates a new quotas collector.
+func New(sessions *sessions.Sessions, logger log.Logger) *Collector {
+	return &Collector{
+		sessions: sessions,
+		l:        log.With(logger, "component", "quotas"),
+		quotas:   make(map[string][]quota),
+	}
+}
+
+// Start refreshes quotas every interval until context is canceled.
+func (c *Collector) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.refresh(ctx)
+
+		select {
+		case <-ticker.C:
+			// nothing
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh loads quotas for all regions, keeping previous values for regions where that failed.
+func (c *Collector) refresh(ctx context.Context) {
+	// quotas are per account and region, not per credentials; use any session for region
+	regions := make(map[string]*session.Session)
+	for s := range c.sessions.AllSessions() {
+		regions[aws.StringValue(s.Config.Region)] = s
+	}
+
+	for region, s := range regions {
+		quotas, err := load(ctx, servicequotas.New(s), region)
+		if err != nil {
+			level.Error(c.l).Log("msg", "Failed to load CloudWatch quotas.", "region", region, "error", err)
+			continue
+		}
+		level.Debug(c.l).Log("msg", fmt.Sprintf("Loaded %d CloudWatch quotas.", len(quotas)), "region", region)
+
+		c.rw.Lock()
+		c.quotas[region] = quotas
+		c.rw.Unlock()
+	}
+}
+
+// load returns CloudWatch quotas for APIs used by the exporter.
+// Applied values are preferred over AWS default ones.
+func load(ctx context.Context, svc servicequotasiface.ServiceQuotasAPI, region string) ([]quota, error) {
+	byCode := make(map[string]quota)
+	add := func(sq *servicequotas.ServiceQuota) {
+		name := aws.StringValue(sq.QuotaName)
+		for _, api := range apis {
+			if strings.Contains(name, api) {
+				code := aws.StringValue(sq.QuotaCode)
+				byCode[code] = quota{
+					region: region,
+					api:    api,
+					code:   code,
+					name:   name,
+					value:  aws.Float64Value(sq.Value),
+				}
+				return
+			}
+		}
+	}
+
+	err := svc.ListAWSDefaultServiceQuotasPagesWithContext(ctx, &servicequotas.ListAWSDefaultServiceQuotasInput{
+		ServiceCode: aws.String(cloudWatchServiceCode),
+	}, func(output *servicequotas.ListAWSDefaultServiceQuotasOutput, lastPage bool) bool {
+		for _, sq := range output.Quotas {
+			add(sq)
+		}
+		return true // continue pagination
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = svc.ListServiceQuotasPagesWithContext(ctx, &servicequotas.ListServiceQuotasInput{
+		ServiceCode: aws.String(cloudWatchServiceCode),
+	}, func(output *servicequotas.ListServiceQuotasOutput, lastPage bool) bool {
+		for _, sq := range output.Quotas {
+			add(sq)
+		}
+		return true // continue pagination
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]quota, 0, len(byCode))
+	for _, q := range byCode {
+		res = append(res, q)
+	}
+	return res, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- limitDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	for _, quotas := range c.quotas {
+		for _, q := range quotas {
+			ch <- prometheus.MustNewConstMetric(limitDesc, prometheus.GaugeValue, q.value, q.region, q.api, q.code, q.name)
+		}
+	}
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+)
@@ -0,0 +1,91 @@
+package quotas
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/servicequotas/servicequotasiface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubServiceQuotas is a Service Quotas API stub that returns fixed default and applied quotas in two pages each.
+type stubServiceQuotas struct {
+	servicequotasiface.ServiceQuotasAPI
+	defaults []*servicequotas.ServiceQuota
+	applied  []*servicequotas.ServiceQuota
+}
+
+func (s stubServiceQuotas) ListAWSDefaultServiceQuotasPagesWithContext(_ aws.Context, input *servicequotas.ListAWSDefaultServiceQuotasInput, fn func(*servicequotas.ListAWSDefaultServiceQuotasOutput, bool) bool, _ ...request.Option) error {
+	if aws.StringValue(input.ServiceCode) != cloudWatchServiceCode {
+		return nil
+	}
+	for i, q := range s.defaults {
+		if !fn(&servicequotas.ListAWSDefaultServiceQuotasOutput{Quotas: []*servicequotas.ServiceQuota{q}}, i == len(s.defaults)-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s stubServiceQuotas) ListServiceQuotasPagesWithContext(_ aws.Context, input *servicequotas.ListServiceQuotasInput, fn func(*servicequotas.ListServiceQuotasOutput, bool) bool, _ ...request.Option) error {
+	if aws.StringValue(input.ServiceCode) != cloudWatchServiceCode {
+		return nil
+	}
+	for i, q := range s.applied {
+		if !fn(&servicequotas.ListServiceQuotasOutput{Quotas: []*servicequotas.ServiceQuota{q}}, i == len(s.applied)-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func serviceQuota(code, name string, value float64) *servicequotas.ServiceQuota {
+	return &servicequotas.ServiceQuota{QuotaCode: aws.String(code), QuotaName: aws.String(name), Value: aws.Float64(value)}
+}
+
+func TestLoad(t *testing.T) {
+	svc := stubServiceQuotas{
+		defaults: []*servicequotas.ServiceQuota{
+			serviceQuota("L-5E141212", "Rate of GetMetricData requests", 50),
+			serviceQuota("L-1B2D4F58", "Rate of GetMetricStatistics requests", 400),
+			serviceQuota("L-F95A5A4C", "Rate of PutMetricData requests", 500),
+		},
+		applied: []*servicequotas.ServiceQuota{
+			serviceQuota("L-5E141212", "Rate of GetMetricData requests", 100),
+		},
+	}
+
+	quotas, err := load(context.Background(), svc, "us-east-1")
+	require.NoError(t, err)
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].code < quotas[j].code })
+	expected := []quota{
+		{region: "us-east-1", api: "GetMetricStatistics", code: "L-1B2D4F58", name: "Rate of GetMetricStatistics requests", value: 400},
+		{region: "us-east-1", api: "GetMetricData", code: "L-5E141212", name: "Rate of GetMetricData requests", value: 100},
+	}
+	assert.Equal(t, expected, quotas)
+}
+
+func TestCollect(t *testing.T) {
+	c := New(nil, promlog.New(&promlog.Config{}))
+	c.quotas["us-east-1"] = []quota{
+		{region: "us-east-1", api: "GetMetricData", code: "L-5E141212", name: "Rate of GetMetricData requests", value: 100},
+	}
+	c.quotas["eu-west-1"] = []quota{
+		{region: "eu-west-1", api: "GetMetricData", code: "L-5E141212", name: "Rate of GetMetricData requests", value: 50},
+	}
+
+	expected := `# HELP rds_exporter_cloudwatch_quota_limit CloudWatch API quota value from AWS Service Quotas.
+# TYPE rds_exporter_cloudwatch_quota_limit gauge
+rds_exporter_cloudwatch_quota_limit{api="GetMetricData",quota_code="L-5E141212",quota_name="Rate of GetMetricData requests",region="eu-west-1"} 50
+rds_exporter_cloudwatch_quota_limit{api="GetMetricData",quota_code="L-5E141212",quota_name="Rate of GetMetricData requests",region="us-east-1"} 100
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
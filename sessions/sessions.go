@@ -1,19 +1,28 @@
 package sessions
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"net/http"
 	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/percona/rds_exporter/config"
 )
@@ -22,6 +31,20 @@ import (
 type Instance struct {
 	Region                     string
 	Instance                   string
+	Engine                     string
+	EngineVersion              string
+	InstanceClass              string // for example, "db.r5.large"
+	StorageType                string
+	AllocatedStorage           int64 // GiB
+	CACertificateIdentifier    string
+	Iops                       int64 // provisioned IOPS, 0 if not provisioned
+	OptionGroups               []OptionGroup
+	MaintenanceWindow          string   // UTC, for example, "sun:05:00-sun:05:30"
+	BackupWindow               string   // UTC, for example, "03:00-03:30"
+	PendingModifications       []string // names of PendingModifiedValues fields, for example, "DBInstanceClass"
+	ReplicaSourceRegion        string   // empty if instance is not a read replica
+	ReplicaSourceInstance      string   // empty if instance is not a read replica
+	ClusterIdentifier          string   // empty if instance is not a member of a DB cluster
 	DisableBasicMetrics        bool
 	DisableEnhancedMetrics     bool
 	ResourceID                 string
@@ -29,6 +52,12 @@ type Instance struct {
 	EnhancedMonitoringInterval time.Duration
 }
 
+// OptionGroup represents instance's option group membership.
+type OptionGroup struct {
+	Name   string
+	Status string // for example, "in-sync" or "pending-apply"
+}
+
 func (i Instance) String() string {
 	res := i.Region + "/" + i.Instance
 	if i.ResourceID != "" {
@@ -38,17 +67,135 @@ func (i Instance) String() string {
 	return res
 }
 
+// ConstLabels returns labels that should be set for all instance's metrics:
+// region, instance, and extra labels from configuration file (empty values remove labels).
+func (i Instance) ConstLabels() prometheus.Labels {
+	res := prometheus.Labels{
+		"region":   i.Region,
+		"instance": i.Instance,
+	}
+	for n, v := range i.ExpandedLabels() {
+		if v == "" {
+			delete(res, n)
+		} else {
+			res[n] = v
+		}
+	}
+	for n, v := range res {
+		res[n] = LimitLabelValue(v)
+	}
+	return res
+}
+
+// ExpandedLabels returns configured labels with metadata templates like "{{.ClusterIdentifier}}" expanded.
+// Templates referencing fields that are not known yet (for example, before metadata is loaded) are expanded to empty strings.
+func (i Instance) ExpandedLabels() map[string]string {
+	if len(i.Labels) == 0 {
+		return i.Labels
+	}
+
+	fields := i.templateFields()
+	res := make(map[string]string, len(i.Labels))
+	for n, v := range i.Labels {
+		res[n] = config.ExpandLabelTemplate(v, fields)
+	}
+	return res
+}
+
+// templateFields returns values of config.LabelTemplateFields.
+func (i Instance) templateFields() map[string]string {
+	return map[string]string{
+		"Region":            i.Region,
+		"Instance":          i.Instance,
+		"Engine":            i.Engine,
+		"EngineVersion":     i.EngineVersion,
+		"InstanceClass":     i.InstanceClass,
+		"StorageType":       i.StorageType,
+		"ClusterIdentifier": i.ClusterIdentifier,
+		"ResourceID":        i.ResourceID,
+	}
+}
+
+// MaxLabelValueLength is a maximum length of label values in bytes; 0 means no limit.
+var MaxLabelValueLength = 0
+
+// labelHashSuffixLength is a length of "-" and hash suffix of truncated label values.
+const labelHashSuffixLength = 9
+
+// LimitLabelValue returns label value truncated to MaxLabelValueLength.
+// Truncated values end with a hash of the full value to keep them unique.
+func LimitLabelValue(v string) string {
+	max := MaxLabelValueLength
+	if max <= 0 || len(v) <= max {
+		return v
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(v))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	if max <= labelHashSuffixLength {
+		return suffix[len(suffix)-max:]
+	}
+
+	// do not split multi-byte characters
+	i := max - labelHashSuffixLength
+	for i > 0 && !utf8.RuneStart(v[i]) {
+		i--
+	}
+	return v[:i] + suffix
+}
+
+// AsyncMetadata makes New return without waiting for initial instances metadata:
+// it is loaded in background while CloudWatch metrics are already collected.
+var AsyncMetadata = false
+
+// Initial and maximal intervals between retries of failed initial DescribeDBInstances calls.
+var (
+	MetadataRetryInitialInterval = time.Second
+	MetadataRetryMaxInterval     = 5 * time.Minute
+)
+
+// Behaviors for instances not found by DescribeDBInstances in their configured region
+// (because of a wrong region, a misspelled identifier, or a deleted instance).
+const (
+	NotFoundSkip = "skip" // log error and skip instance
+	NotFoundWarn = "warn" // log warning and keep instance without metadata
+)
+
+// NotFound is a behavior for instances not found by DescribeDBInstances in their configured region.
+var NotFound = NotFoundSkip
+
 // Sessions is a pool of AWS sessions.
 type Sessions struct {
+	l        log.Logger
+	rw       sync.RWMutex
 	sessions map[*session.Session][]Instance
+	pending  map[*session.Session][]Instance // sessions without loaded metadata; instances have only configuration fields
+
+	watchers []func(*session.Session, []Instance) // called when pending session is loaded
+
+	mMetadataLoaded prometheus.Gauge
+	mNotFound       *prometheus.CounterVec
 }
 
 // New creates a new sessions pool for given configuration.
-func New(instances []config.Instance, client *http.Client, logger log.Logger, trace bool) (*Sessions, error) {
+// If trace is true, all AWS requests and responses are logged, including credentials.
+// If debugRequests is true, AWS requests and responses are logged without bodies and with sensitive headers redacted.
+func New(instances []config.Instance, client *http.Client, logger log.Logger, trace, debugRequests bool) (*Sessions, error) {
 	logger = log.With(logger, "component", "sessions")
 	level.Info(logger).Log("msg", "Creating sessions...")
 	res := &Sessions{
+		l:        logger,
 		sessions: make(map[*session.Session][]Instance),
+
+		mMetadataLoaded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "rds_exporter_metadata_loaded",
+			Help: "1 if initial RDS instances metadata was loaded for all sessions, 0 otherwise.",
+		}),
+		mNotFound: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rds_exporter_instances_not_found_total",
+			Help: "Total number of times configured instance was not found by DescribeDBInstances in its configured region (wrong region or deleted instance).",
+		}, []string{"region", "instance"}),
 	}
 
 	sharedSessions := make(map[string]*session.Session) // region/key => session
@@ -93,6 +240,11 @@ func New(instances []config.Instance, client *http.Client, logger log.Logger, tr
 			level := aws.LogDebugWithSigning | aws.LogDebugWithHTTPBody
 			level |= aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors | aws.LogDebugWithEventStreamBody
 			awsCfg.LogLevel = aws.LogLevel(level)
+		} else if debugRequests {
+			awsCfg.Logger = aws.LoggerFunc(func(args ...interface{}) {
+				level.Debug(logger).Log("msg", redactHeaders(fmt.Sprint(args...)))
+			})
+			awsCfg.LogLevel = aws.LogLevel(aws.LogDebug | aws.LogDebugWithRequestRetries | aws.LogDebugWithRequestErrors)
 		}
 
 		// store session
@@ -110,44 +262,39 @@ func New(instances []config.Instance, client *http.Client, logger log.Logger, tr
 		})
 	}
 
-	// add resource ID to all instances
-	for session, instances := range res.sessions {
-		svc := rds.New(session)
-		var marker *string
-		for {
-			output, err := svc.DescribeDBInstances(&rds.DescribeDBInstancesInput{
-				Marker: marker,
-			})
-			if err != nil {
-				level.Error(logger).Log("msg", "Failed to get resource IDs.", "error", err)
-				break
-			}
+	// add resource ID to all instances in parallel; sessions where that failed are retried in background
+	failed := make(map[*session.Session][]Instance)
+	if AsyncMetadata {
+		for session, instances := range res.sessions {
+			failed[session] = instances
+			delete(res.sessions, session)
+		}
+	} else {
+		var wg sync.WaitGroup
+		var m sync.Mutex
+		for session, instances := range res.sessions {
+			session, instances := session, instances
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
 
-			for _, dbInstance := range output.DBInstances {
-				for i, instance := range instances {
-					if *dbInstance.DBInstanceIdentifier == instance.Instance {
-						instances[i].ResourceID = *dbInstance.DbiResourceId
-						instances[i].EnhancedMonitoringInterval = time.Duration(*dbInstance.MonitoringInterval) * time.Second
-					}
+				if err := describeInstances(session, instances); err != nil {
+					level.Error(logger).Log("msg", "Failed to get resource IDs, will retry.", "error", err)
+					m.Lock()
+					failed[session] = instances
+					m.Unlock()
 				}
-			}
-			if marker = output.Marker; marker == nil {
-				break
-			}
+			}()
 		}
-	}
+		wg.Wait()
 
-	// remove instances without resource ID
-	for session, instances := range res.sessions {
-		newInstances := make([]Instance, 0, len(instances))
-		for _, instance := range instances {
-			if instance.ResourceID == "" {
-				level.Error(logger).Log("msg", fmt.Sprintf("Skipping %s - can't determine resourceID.", instance))
+		for session, instances := range res.sessions {
+			if _, ok := failed[session]; ok {
+				delete(res.sessions, session)
 				continue
 			}
-			newInstances = append(newInstances, instance)
+			res.sessions[session] = res.checkFound(instances)
 		}
-		res.sessions[session] = newInstances
 	}
 
 	// remove sessions without instances
@@ -156,7 +303,6 @@ func New(instances []config.Instance, client *http.Client, logger log.Logger, tr
 			delete(res.sessions, s)
 		}
 	}
-
 	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
 	fmt.Fprintf(w, "Region\tInstance\tResource ID\tInterval\n")
 	for _, instances := range res.sessions {
@@ -167,15 +313,254 @@ func New(instances []config.Instance, client *http.Client, logger log.Logger, tr
 	_ = w.Flush()
 
 	level.Info(logger).Log("msg", fmt.Sprintf("Using %d sessions.", len(res.sessions)))
+
+	res.pending = make(map[*session.Session][]Instance, len(failed))
+	for session, instances := range failed {
+		res.pending[session] = append([]Instance(nil), instances...)
+	}
+	if len(res.pending) == 0 {
+		res.mMetadataLoaded.Set(1)
+	}
+	for session, instances := range failed {
+		go res.retryDescribe(session, instances, AsyncMetadata, logger)
+	}
+
 	return res, nil
 }
 
+// sensitiveHeadersRE matches values of HTTP headers that should not be logged.
+var sensitiveHeadersRE = regexp.MustCompile(`(?im)^((?:authorization|x-amz-security-token|x-amz-content-sha256):[ \t]*)[^\r\n]*`)
+
+// redactHeaders replaces values of sensitive headers in AWS SDK request and response dumps.
+func redactHeaders(s string) string {
+	return sensitiveHeadersRE.ReplaceAllString(s, "${1}REDACTED")
+}
+
+// describeInstances fills resource IDs and other metadata of instances sharing a single session.
+func describeInstances(session *session.Session, instances []Instance) error {
+	svc := rds.New(session)
+	var marker *string
+	for {
+		output, err := svc.DescribeDBInstances(&rds.DescribeDBInstancesInput{
+			Marker: marker,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, dbInstance := range output.DBInstances {
+			for i, instance := range instances {
+				if *dbInstance.DBInstanceIdentifier == instance.Instance {
+					instances[i].ResourceID = *dbInstance.DbiResourceId
+					instances[i].Engine = aws.StringValue(dbInstance.Engine)
+					instances[i].EngineVersion = aws.StringValue(dbInstance.EngineVersion)
+					instances[i].InstanceClass = aws.StringValue(dbInstance.DBInstanceClass)
+					instances[i].StorageType = aws.StringValue(dbInstance.StorageType)
+					instances[i].AllocatedStorage = aws.Int64Value(dbInstance.AllocatedStorage)
+					instances[i].CACertificateIdentifier = aws.StringValue(dbInstance.CACertificateIdentifier)
+					instances[i].Iops = aws.Int64Value(dbInstance.Iops)
+					instances[i].MaintenanceWindow = aws.StringValue(dbInstance.PreferredMaintenanceWindow)
+					instances[i].BackupWindow = aws.StringValue(dbInstance.PreferredBackupWindow)
+					instances[i].PendingModifications = pendingModifications(dbInstance.PendingModifiedValues)
+					instances[i].ReplicaSourceRegion, instances[i].ReplicaSourceInstance = replicaSource(
+						instance.Region, aws.StringValue(dbInstance.ReadReplicaSourceDBInstanceIdentifier),
+					)
+					instances[i].ClusterIdentifier = aws.StringValue(dbInstance.DBClusterIdentifier)
+					instances[i].OptionGroups = make([]OptionGroup, len(dbInstance.OptionGroupMemberships))
+					for j, m := range dbInstance.OptionGroupMemberships {
+						instances[i].OptionGroups[j] = OptionGroup{
+							Name:   aws.StringValue(m.OptionGroupName),
+							Status: aws.StringValue(m.Status),
+						}
+					}
+					instances[i].EnhancedMonitoringInterval = time.Duration(*dbInstance.MonitoringInterval) * time.Second
+				}
+			}
+		}
+		if marker = output.Marker; marker == nil {
+			return nil
+		}
+	}
+}
+
+// replicaSource returns region and identifier of read replica source.
+// Source is an identifier for the same region and ARN for cross-region replicas.
+func replicaSource(region, source string) (string, string) {
+	if source == "" {
+		return "", ""
+	}
+	if !arn.IsARN(source) {
+		return region, source
+	}
+
+	a, err := arn.Parse(source)
+	if err != nil {
+		return region, source
+	}
+	return a.Region, strings.TrimPrefix(a.Resource, "db:")
+}
+
+// pendingModifications returns names of set fields of PendingModifiedValues.
+func pendingModifications(v *rds.PendingModifiedValues) []string {
+	if v == nil {
+		return nil
+	}
+
+	var res []string
+	rv := reflect.ValueOf(v).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		switch fv := rv.Field(i); fv.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if fv.IsNil() || (fv.Kind() != reflect.Ptr && fv.Len() == 0) {
+				continue
+			}
+			res = append(res, f.Name)
+		}
+	}
+	return res
+}
+
+// checkFound handles instances that were not returned by DescribeDBInstances in their configured region
+// (and so have no resource ID) according to NotFound. It returns instances that should be kept.
+func (s *Sessions) checkFound(instances []Instance) []Instance {
+	res := make([]Instance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.ResourceID == "" {
+			s.mNotFound.WithLabelValues(instance.Region, instance.Instance).Inc()
+			msg := fmt.Sprintf("Instance %s was not found in region %q; check that region and identifier are correct and instance exists.", instance, instance.Region)
+			if NotFound == NotFoundSkip {
+				level.Error(s.l).Log("msg", msg+" Skipping.")
+				continue
+			}
+			level.Warn(s.l).Log("msg", msg+" Metrics will likely be empty.")
+		}
+		res = append(res, instance)
+	}
+	return res
+}
+
+// nextBackoff returns doubled retry interval limited by max.
+func nextBackoff(current, max time.Duration) time.Duration {
+	current *= 2
+	if current > max {
+		current = max
+	}
+	return current
+}
+
+// retryDescribe retries loading of instances metadata with exponential backoff until it succeeds,
+// then adds the session to the pool. If immediate is true, the first attempt is made without delay.
+func (s *Sessions) retryDescribe(session *session.Session, instances []Instance, immediate bool, logger log.Logger) {
+	interval := MetadataRetryInitialInterval
+	wait := interval
+	if immediate {
+		wait = 0
+	}
+	for {
+		time.Sleep(wait)
+
+		err := describeInstances(session, instances)
+		if err == nil {
+			break
+		}
+		if wait > 0 {
+			interval = nextBackoff(interval, MetadataRetryMaxInterval)
+		}
+		wait = interval
+		level.Error(logger).Log("msg", fmt.Sprintf("Failed to get resource IDs, will retry in %s.", interval), "error", err)
+	}
+
+	instances = s.checkFound(instances)
+	level.Info(logger).Log("msg", fmt.Sprintf("Loaded metadata for %d instances.", len(instances)))
+	s.setLoaded(session, instances)
+}
+
+// setLoaded moves pending session with loaded instances metadata to the pool and notifies watchers.
+func (s *Sessions) setLoaded(sess *session.Session, instances []Instance) {
+	s.rw.Lock()
+	if len(instances) > 0 {
+		s.sessions[sess] = instances
+	}
+	delete(s.pending, sess)
+	if len(s.pending) == 0 {
+		s.mMetadataLoaded.Set(1)
+	}
+	watchers := make([]func(*session.Session, []Instance), len(s.watchers))
+	copy(watchers, s.watchers)
+	s.rw.Unlock()
+
+	if len(instances) == 0 {
+		return
+	}
+	for _, w := range watchers {
+		w(sess, instances)
+	}
+}
+
+// WatchLoaded returns all sessions and instances with loaded metadata (like AllSessions),
+// and calls fn for every session loaded later, for example, after failed initial DescribeDBInstances calls
+// or with AsyncMetadata. Together they cover every session exactly once.
+func (s *Sessions) WatchLoaded(fn func(*session.Session, []Instance)) map[*session.Session][]Instance {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.watchers = append(s.watchers, fn)
+	res := make(map[*session.Session][]Instance, len(s.sessions))
+	for session, instances := range s.sessions {
+		res[session] = instances
+	}
+	return res
+}
+
+// StartRefresh refreshes instances metadata every interval until context is canceled.
+func (s *Sessions) StartRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refresh()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh reloads metadata of instances in all loaded sessions,
+// keeping previous metadata for sessions where that failed.
+func (s *Sessions) refresh() {
+	for session, instances := range s.AllSessions() {
+		instances = append([]Instance(nil), instances...)
+		if err := describeInstances(session, instances); err != nil {
+			level.Warn(s.l).Log("msg", "Failed to refresh metadata, keeping previous one.", "error", err)
+			continue
+		}
+
+		s.rw.Lock()
+		s.sessions[session] = instances
+		s.rw.Unlock()
+	}
+	level.Debug(s.l).Log("msg", "Metadata refreshed.")
+}
+
 // GetSession returns session and full instance information for given region and instance.
+// If instance's metadata is still being loaded, returned information contains only configuration fields
+// (and empty ResourceID).
 func (s *Sessions) GetSession(region, instance string) (*session.Session, *Instance) {
-	for session, instances := range s.sessions {
-		for _, i := range instances {
-			if i.Region == region && i.Instance == instance {
-				return session, &i
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	for _, sessions := range []map[*session.Session][]Instance{s.sessions, s.pending} {
+		for session, instances := range sessions {
+			for _, i := range instances {
+				if i.Region == region && i.Instance == instance {
+					return session, &i
+				}
 			}
 		}
 	}
@@ -206,6 +591,31 @@ func buildCredentials(instance config.Instance) (*credentials.Credentials, error
 }
 
 // AllSessions returns all sessions and instances.
+// Sessions with metadata that is still being loaded are not included.
 func (s *Sessions) AllSessions() map[*session.Session][]Instance {
-	return s.sessions
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	res := make(map[*session.Session][]Instance, len(s.sessions))
+	for session, instances := range s.sessions {
+		res[session] = instances
+	}
+	return res
+}
+
+// Describe implements prometheus.Collector.
+func (s *Sessions) Describe(ch chan<- *prometheus.Desc) {
+	s.mMetadataLoaded.Describe(ch)
+	s.mNotFound.Describe(ch)
 }
+
+// Collect implements prometheus.Collector.
+func (s *Sessions) Collect(ch chan<- prometheus.Metric) {
+	s.mMetadataLoaded.Collect(ch)
+	s.mNotFound.Collect(ch)
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Sessions)(nil)
+)
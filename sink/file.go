@@ -0,0 +1,92 @@
+// Package sink writes collected metrics to destinations other than the HTTP endpoints.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// File periodically writes gathered metrics to a file in OpenMetrics text format.
+//
+// Every write goes to a temporary file in the same directory which is then renamed over the target,
+// so readers never see a partially written file.
+type File struct {
+	path     string
+	gatherer prometheus.Gatherer
+	l        log.Logger
+}
+
+// NewFile creates a new file sink for given path.
+func NewFile(path string, gatherer prometheus.Gatherer, logger log.Logger) *File {
+	return &File{
+		path:     path,
+		gatherer: gatherer,
+		l:        log.With(logger, "component", "sink"),
+	}
+}
+
+// Run writes metrics every interval until context is canceled.
+func (f *File) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Write(); err != nil {
+			level.Error(f.l).Log("msg", "Failed to write metrics file.", "path", f.path, "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+			// nothing
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Write gathers metrics and atomically replaces the file with them.
+func (f *File) Write() error {
+	mfs, err := f.gatherer.Gather()
+	if err != nil {
+		// same as promhttp.ContinueOnError: write what was gathered
+		if len(mfs) == 0 {
+			return err
+		}
+		level.Warn(f.l).Log("msg", "Error gathering metrics, writing partial result.", "error", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	enc := expfmt.NewEncoder(tmp, expfmt.FmtOpenMetrics)
+	for _, mf := range mfs {
+		if err = enc.Encode(mf); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to encode %s: %w", mf.GetName(), err)
+		}
+	}
+	if _, err = expfmt.FinalizeOpenMetrics(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
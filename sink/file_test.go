@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWrite(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "test_gauge",
+		Help: "Test gauge.",
+	})
+	g.Set(42)
+	registry.MustRegister(g)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.txt")
+	f := NewFile(path, registry, promlog.New(&promlog.Config{}))
+	require.NoError(t, f.Write())
+
+	b, err := os.ReadFile(path) //nolint:gosec
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, []string{
+		"# HELP test_gauge Test gauge.",
+		"# TYPE test_gauge gauge",
+		"test_gauge 42.0",
+		"# EOF",
+	}, lines)
+
+	// temporary files are not left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}